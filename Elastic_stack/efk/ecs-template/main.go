@@ -0,0 +1,59 @@
+// ecs-template печатает настройки Elasticsearch для логов ECS из pkg/ecslog:
+//
+//	ecs-template template  - шаблон индекса, PUT _index_template/<имя>
+//	ecs-template pipeline  - ingest pipeline, PUT _ingest/pipeline/<имя>
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Deny7676yar/observability/pkg/config"
+	"github.com/Deny7676yar/observability/pkg/ecslog"
+)
+
+// Config - параметры шаблона, загружаются config.FromEnv.
+type Config struct {
+	IndexPattern string `json:"index_pattern" env:"INDEX_PATTERN" default:"logs-*"`
+	Pipeline     string `json:"pipeline" env:"PIPELINE" default:"ecs-logs"`
+	Replicas     int    `json:"replicas" env:"REPLICAS" default:"0"`
+}
+
+func (c *Config) Validate() error {
+	if c.Replicas < 0 {
+		return fmt.Errorf("replicas must not be negative, got %d", c.Replicas)
+	}
+	return nil
+}
+
+func main() {
+	var cfg Config
+	if err := config.FromEnv(&cfg); err != nil {
+		log.Fatal(err)
+	}
+	if len(os.Args) != 2 {
+		log.Fatalf("usage: %s template|pipeline", os.Args[0])
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+	switch os.Args[1] {
+	case "template":
+		b, err = ecslog.Template{
+			Patterns: []string{cfg.IndexPattern},
+			Pipeline: cfg.Pipeline,
+			Replicas: cfg.Replicas,
+		}.JSON()
+	case "pipeline":
+		b, err = ecslog.IngestPipeline()
+	default:
+		log.Fatalf("unknown document %q, want template or pipeline", os.Args[1])
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(b))
+}
@@ -6,59 +6,76 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/Deny7676yar/observability/pkg/dbmetrics"
+	"github.com/Deny7676yar/observability/pkg/health"
+	"github.com/Deny7676yar/observability/pkg/lifecycle"
+	"github.com/Deny7676yar/observability/pkg/logctx"
+	"github.com/Deny7676yar/observability/pkg/loglevel"
+	"github.com/Deny7676yar/observability/pkg/pgxtrace"
+	"github.com/Deny7676yar/observability/pkg/recovery"
+	"github.com/Deny7676yar/observability/pkg/requestid"
+	"github.com/Deny7676yar/observability/pkg/sentryreport"
+	"github.com/Deny7676yar/observability/pkg/tracing"
+	"github.com/getsentry/sentry-go"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/log/zapadapter"
 	"github.com/jackc/pgx/v4/pgxpool"
-	"github.com/opentracing-contrib/go-stdlib/nethttp"
-	"github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 type app struct {
+	cfg        Config
 	logger     *zap.Logger
-	tracer     opentracing.Tracer
+	levels     *loglevel.Levels
+	sentry     *sentry.Hub
+	recovery   *recovery.Recovery
+	tp         trace.TracerProvider
+	tracer     trace.Tracer
 	pool       *pgxpool.Pool
 	repository *Repository
 }
 
 func (a *app) parseUserID(ctx context.Context, r *http.Request) (*uuid.UUID, error) {
-	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, a.tracer, "parseUserID")
-	defer span.Finish()
+	ctx, span := a.tracer.Start(ctx, "parseUserID")
+	defer span.End()
 	strUserID := chi.URLParam(r, "id")
 	if strUserID == "" {
 		return nil, nil
 	}
 	userID, err := uuid.Parse(strUserID)
 	if err != nil {
-		a.logger.Debug(
+		logctx.Zap(ctx, a.logger).Debug(
 			fmt.Sprintf("failed to parse userID (uuid) from: '%s'", strUserID),
 			zap.Field{Key: "error", String: err.Error(), Type: zapcore.StringType},
 		)
-		span.LogFields(
-			log.Error(err),
-		)
+		spanError(span, err)
 		return nil, err
 	}
-	a.logger.Debug(fmt.Sprintf("userID parsed: %s", userID))
+	span.SetAttributes(attribute.String("user.id", userID.String()))
+	logctx.Zap(ctx, a.logger).Debug(fmt.Sprintf("userID parsed: %s", userID))
 	return &userID, nil
 }
 
 func (a *app) usersHandler(w http.ResponseWriter, r *http.Request) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(r.Context(), a.tracer, "usersHandler")
-	defer span.Finish()
-	a.logger.Info("usersHandler called", zap.Field{Key: "method", String: r.Method,
+	ctx, span := a.tracer.Start(r.Context(), "usersHandler")
+	defer span.End()
+	logctx.Zap(ctx, a.logger).Info("usersHandler called", zap.Field{Key: "method", String: r.Method,
 		Type: zapcore.StringType})
 	users, err := a.repository.GetUsers(ctx)
 	if err != nil {
 		msg := fmt.Sprintf(`failed to get users: %s`, err)
-		a.logger.Error(msg)
-		span.LogFields(
-			log.Error(err),
-		)
+		logctx.Zap(ctx, a.logger).Error("failed to get users", zap.Error(err))
+		spanError(span, err)
 		writeResponse(w, http.StatusInternalServerError, msg)
 		return
 	}
@@ -66,9 +83,9 @@ func (a *app) usersHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *app) userHandler(w http.ResponseWriter, r *http.Request) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(r.Context(), a.tracer, "userHandler")
-	defer span.Finish()
-	a.logger.Info("userHandler called", zap.Field{Key: "method", String: r.Method,
+	ctx, span := a.tracer.Start(r.Context(), "userHandler")
+	defer span.End()
+	logctx.Zap(ctx, a.logger).Info("userHandler called", zap.Field{Key: "method", String: r.Method,
 		Type: zapcore.StringType})
 	userID, err := a.parseUserID(ctx, r)
 	if err != nil {
@@ -82,9 +99,8 @@ func (a *app) userHandler(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, ErrNotFound):
 			status = http.StatusNotFound
 		default:
-			span.LogFields(
-				log.Error(err),
-			)
+			logctx.Zap(ctx, a.logger).Error("failed to get user", zap.Error(err))
+			spanError(span, err)
 		}
 		writeResponse(w, status, fmt.Sprintf(`failed to get user with id %s: %s`,
 			userID, err))
@@ -94,55 +110,131 @@ func (a *app) userHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *app) userArticlesHandler(w http.ResponseWriter, r *http.Request) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(r.Context(), a.tracer, "userArticlesHandler")
-	defer span.Finish()
-	a.logger.Info("userArticlesHandler called", zap.Field{Key: "method", String: r.Method, Type: zapcore.StringType})
+	ctx, span := a.tracer.Start(r.Context(), "userArticlesHandler")
+	defer span.End()
+	logctx.Zap(ctx, a.logger).Info("userArticlesHandler called", zap.Field{Key: "method", String: r.Method, Type: zapcore.StringType})
 	userID, err := a.parseUserID(ctx, r)
 	if err != nil {
-		span.LogFields(
-			log.Error(err),
-		)
+		spanError(span, err)
 		writeResponse(w, http.StatusBadRequest, fmt.Sprintf(`failed to parse user's id: %s`, err))
 		return
 	}
 	articles, err := a.repository.GetUserArticles(ctx, *userID)
 	if err != nil {
+		logctx.Zap(ctx, a.logger).Error("failed to get user's articles", zap.Error(err))
+		spanError(span, err)
 		writeResponse(w, http.StatusInternalServerError, fmt.Sprintf(`failed to get user's (id: %s) articles: %s`, userID, err))
 		return
 	}
 	writeJsonResponse(w, http.StatusOK, articles)
 }
+
+// panicHandler - проверка recovery: паника превращается в ответ 500 и запись в логе.
 func (a *app) panicHandler(w http.ResponseWriter, r *http.Request) {
-	defer func() {
-		_ = recover()
-		writeResponse(w, http.StatusOK, "panic logged, see server log")
-	}()
-	a.logger.Panic("panic!!!")
+	panic("panic!!!")
 }
 
-func (a *app) Init(ctx context.Context, logger *zap.Logger, tracer opentracing.Tracer) error {
-	config, err := pgxpool.ParseConfig(DatabaseURL)
+func (a *app) Init(ctx context.Context, cfg Config, logger *zap.Logger, tp trace.TracerProvider, hub *sentry.Hub, levels *loglevel.Levels) error {
+	config, err := pgxpool.ParseConfig(cfg.DatabaseURL)
 	if err != nil {
-		return fmt.Errorf("failed to parse conn string (%s): %w", DatabaseURL, err)
+		return fmt.Errorf("failed to parse conn string: %w", err)
 	}
 	config.ConnConfig.LogLevel = pgx.LogLevelDebug
-	config.ConnConfig.Logger = zapadapter.NewLogger(logger) // логгер запросов в БД
+	var opts []pgxtrace.Option
+	if cfg.TraceSQLArgs {
+		opts = append(opts, pgxtrace.WithArgs(pgxtrace.RedactColumns("name")))
+	}
+	// логгер запросов в БД, он же создаёт спан на каждый запрос
+	config.ConnConfig.Logger = pgxtrace.NewLogger(tp, zapadapter.NewLogger(levels.Named(logger, "pgx")), opts...)
 	pool, err := pgxpool.ConnectConfig(ctx, config)
 	if err != nil {
 		return fmt.Errorf("unable to connect to database: %w", err)
 	}
-	a.logger = logger
-	a.tracer = tracer
+	a.cfg = cfg
+	a.levels = levels
+	a.logger = levels.Named(logger, "http")
+	a.sentry = hub
+	if a.recovery, err = recovery.New(prometheus.DefaultRegisterer, Namespace); err != nil {
+		return err
+	}
+	a.tp = tp
+	a.tracer = tp.Tracer(ServiceName)
 	a.pool = pool
-	a.repository = NewRepository(a.pool, a.tracer)
+	metrics := dbmetrics.NewCollector(Namespace, "example", dbmetrics.PgxPoolStats(pool), ErrNotFound)
+	if err := prometheus.Register(metrics); err != nil {
+		return fmt.Errorf("failed to register db metrics: %w", err)
+	}
+	a.repository = NewRepository(a.pool, a.tracer, metrics)
 	return a.repository.InitSchema(ctx)
 }
 
-func (a *app) Serve() error {
+// Handler - маршруты сервиса. Входящий контекст трейса извлекается из заголовков W3C,
+// серверный спан называется по шаблону маршрута, X-Request-ID принимается или создаётся,
+// паники обработчиков превращаются в ответ 500. Пробы и /metrics не трейсятся.
+func (a *app) Handler(hc *health.Checker) http.Handler {
 	r := chi.NewRouter()
+	r.Use(routeSpanName, requestid.Middleware, a.recovery.Middleware(a.logger, routePattern), sentryreport.Middleware(a.sentry))
+	r.Handle("/healthz", hc.LiveHandler())
+	r.Handle("/readyz", hc.ReadyHandler())
 	r.Get("/users", http.HandlerFunc(a.usersHandler))
 	r.Get("/users/{id}", http.HandlerFunc(a.userHandler))
 	r.Get("/users/{id}/articles", http.HandlerFunc(a.userArticlesHandler))
 	r.Get("/panic", http.HandlerFunc(a.panicHandler))
-	return http.ListenAndServe("0.0.0.0:9000", nethttp.Middleware(a.tracer, r))
+	r.Handle("/metrics", promhttp.Handler())
+	return otelhttp.NewHandler(r, "http.server",
+		otelhttp.WithTracerProvider(a.tp),
+		otelhttp.WithPropagators(tracing.Propagator()),
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			switch r.URL.Path {
+			case "/healthz", "/readyz", "/metrics":
+				return false
+			}
+			return true
+		}),
+	)
+}
+
+// DebugHandler - служебные маршруты, слушаются отдельно от API на Config.DebugAddr.
+func (a *app) DebugHandler() http.Handler {
+	r := chi.NewRouter()
+	// уровни логов: GET - текущие, PUT {"level", "component", "ttl"} - изменить
+	r.Handle("/debug/loglevel", a.levels.Handler())
+	return r
+}
+
+// routeSpanName переименовывает серверный спан в "GET /users/{id}" после того, как chi выбрал маршрут.
+func routeSpanName(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		route := routePattern(r)
+		if route == "" {
+			return
+		}
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(semconv.HTTPRouteKey.String(route))
+	})
+}
+
+// routePattern - шаблон маршрута, выбранного chi, или "", если запрос ни в один не попал.
+func routePattern(r *http.Request) string {
+	if rc := chi.RouteContext(r.Context()); rc != nil {
+		return rc.RoutePattern()
+	}
+	return ""
+}
+
+// spanError отмечает спан как завершившийся ошибкой.
+func spanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Serve обслуживает запросы до отмены ctx, затем останавливает сервер через lifecycle.Manager.
+func (a *app) Serve(ctx context.Context, hc *health.Checker) error {
+	lc := lifecycle.New(lifecycle.DefaultShutdownTimeout)
+	lc.OnShutdown(hc.Drain)
+	lc.Add("http", &http.Server{Addr: a.cfg.HTTPAddr, Handler: a.Handler(hc)})
+	lc.Add("debug", &http.Server{Addr: a.cfg.DebugAddr, Handler: a.DebugHandler()})
+	return lc.Run(ctx)
 }
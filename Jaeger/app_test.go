@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Deny7676yar/observability/pkg/health"
+	"github.com/Deny7676yar/observability/pkg/loglevel"
+	"github.com/Deny7676yar/observability/pkg/recovery"
+	"github.com/Deny7676yar/observability/pkg/requestid"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(AppSuite))
+
+type AppSuite struct {
+	sr   *tracetest.SpanRecorder
+	logs *observer.ObservedLogs
+	h    http.Handler
+	dh   http.Handler
+}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *AppSuite) SetUpTest(c *gc.C) {
+	s.sr = tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(s.sr))
+	core, logs := observer.New(zapcore.DebugLevel)
+	s.logs = logs
+	rc, err := recovery.New(prometheus.NewRegistry(), Namespace)
+	c.Assert(err, gc.IsNil)
+	levels, err := loglevel.New("debug")
+	c.Assert(err, gc.IsNil)
+	a := &app{logger: zap.New(core), levels: levels, tp: tp, tracer: tp.Tracer(ServiceName), recovery: rc}
+	s.h = a.Handler(health.New(0))
+	s.dh = a.DebugHandler()
+}
+
+func (s *AppSuite) spans() map[string]sdktrace.ReadOnlySpan {
+	ret := make(map[string]sdktrace.ReadOnlySpan)
+	for _, sp := range s.sr.Ended() {
+		ret[sp.Name()] = sp
+	}
+	return ret
+}
+
+func (s *AppSuite) TestServerSpanContinuesIncomingTrace(c *gc.C) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	req := httptest.NewRequest(http.MethodGet, "/users/not-a-uuid", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+spanID+"-01")
+	rec := httptest.NewRecorder()
+	s.h.ServeHTTP(rec, req)
+	c.Assert(rec.Code, gc.Equals, http.StatusBadRequest)
+
+	spans := s.spans()
+	server, ok := spans["GET /users/{id}"]
+	c.Assert(ok, gc.Equals, true, gc.Commentf("spans: %v", spans))
+	c.Assert(server.SpanContext().TraceID().String(), gc.Equals, traceID)
+	c.Assert(server.Parent().SpanID().String(), gc.Equals, spanID)
+	c.Assert(server.Parent().IsRemote(), gc.Equals, true)
+	route := false
+	for _, kv := range server.Attributes() {
+		if kv.Key == semconv.HTTPRouteKey {
+			route = kv.Value.AsString() == "/users/{id}"
+		}
+	}
+	c.Assert(route, gc.Equals, true)
+
+	handler := spans["userHandler"]
+	c.Assert(handler.Parent().SpanID(), gc.Equals, server.SpanContext().SpanID())
+	parse := spans["parseUserID"]
+	c.Assert(parse.Parent().SpanID(), gc.Equals, handler.SpanContext().SpanID())
+	c.Assert(parse.Status().Code, gc.Equals, codes.Error)
+	c.Assert(parse.Events(), gc.HasLen, 1, gc.Commentf("error must be recorded as an event"))
+}
+
+func (s *AppSuite) TestRequestIDInResponseSpanAndLogs(c *gc.C) {
+	req := httptest.NewRequest(http.MethodGet, "/users/not-a-uuid", nil)
+	req.Header.Set(requestid.Header, "req-42")
+	rec := httptest.NewRecorder()
+	s.h.ServeHTTP(rec, req)
+	c.Assert(rec.Header().Get(requestid.Header), gc.Equals, "req-42")
+
+	server := s.spans()["GET /users/{id}"]
+	found := false
+	for _, kv := range server.Attributes() {
+		if kv.Key == requestid.AttributeKey {
+			found = kv.Value.AsString() == "req-42"
+		}
+	}
+	c.Assert(found, gc.Equals, true)
+	c.Assert(s.logs.Len() > 0, gc.Equals, true)
+	for _, e := range s.logs.All() {
+		c.Assert(e.ContextMap()["request_id"], gc.Equals, "req-42", gc.Commentf("log %q", e.Message))
+		c.Assert(e.ContextMap()["trace_id"], gc.Equals, server.SpanContext().TraceID().String())
+	}
+}
+
+func (s *AppSuite) TestProbesAreNotTraced(c *gc.C) {
+	for _, path := range []string{"/healthz", "/readyz"} {
+		rec := httptest.NewRecorder()
+		s.h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	}
+	c.Assert(s.sr.Ended(), gc.HasLen, 0)
+}
+
+func (s *AppSuite) TestPanicReturns500(c *gc.C) {
+	rec := httptest.NewRecorder()
+	s.h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	c.Assert(rec.Code, gc.Equals, http.StatusInternalServerError)
+	c.Assert(rec.Body.String(), gc.Equals, "{\"error\":\"internal server error\"}\n")
+
+	span := s.spans()["GET /panic"]
+	c.Assert(span, gc.NotNil)
+	c.Assert(span.Status().Code, gc.Equals, codes.Error)
+	entries := s.logs.FilterMessage("panic recovered").All()
+	c.Assert(entries, gc.HasLen, 1)
+	c.Assert(entries[0].ContextMap()[recovery.LabelRoute], gc.Equals, "/panic")
+}
+
+func (s *AppSuite) TestLogLevelEndpoint(c *gc.C) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/debug/loglevel", strings.NewReader(`{"level":"warn","ttl":"1m"}`))
+	s.dh.ServeHTTP(rec, req)
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+	c.Assert(rec.Body.String(), gc.Matches, `(?s)\{"global":"warn","global_expires_at":.*`)
+	c.Assert(s.sr.Ended(), gc.HasLen, 0, gc.Commentf("admin endpoint is not traced"))
+
+	rec = httptest.NewRecorder()
+	s.h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/loglevel", nil))
+	c.Assert(rec.Code, gc.Equals, http.StatusNotFound, gc.Commentf("admin endpoint is not on the API router"))
+}
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS users
+(
+id uuid NOT NULL
+CONSTRAINT users_pk
+PRIMARY KEY,
+name varchar(150) NOT NULL
+);
+CREATE TABLE IF NOT EXISTS articles
+(
+id uuid NOT NULL
+CONSTRAINT articles_pk
+PRIMARY KEY,
+title varchar(150) NOT NULL,
+text text NOT NULL,
+user_id uuid
+CONSTRAINT articles_users_id_fk
+REFERENCES users
+);
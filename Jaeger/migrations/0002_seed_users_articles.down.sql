@@ -0,0 +1,7 @@
+DELETE FROM public.articles WHERE id IN (
+'e4e12c87-88d8-413c-8ab6-57bfa4e953a8',
+'68792339-715c-4823-a4d5-a85cefec8d36',
+'e095e3a2-5b8e-4bc8-b793-bc3606c4fdd5');
+DELETE FROM public.users WHERE id IN (
+'b29f95a2-499a-4079-97f5-ff55c3854fcb',
+'b6dede74-ad09-4bb7-a036-997ab3ab3130');
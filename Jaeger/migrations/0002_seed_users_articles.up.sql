@@ -0,0 +1,12 @@
+INSERT INTO public.users (id, name) VALUES
+('b29f95a2-499a-4079-97f5-ff55c3854fcb', 'usr1'),
+('b6dede74-ad09-4bb7-a036-997ab3ab3130', 'usr2')
+ON CONFLICT (id) DO NOTHING;
+INSERT INTO public.articles (id, title, text, user_id) VALUES
+('e4e12c87-88d8-413c-8ab6-57bfa4e953a8', 'article_11', 'some text',
+'b29f95a2-499a-4079-97f5-ff55c3854fcb'),
+('68792339-715c-4823-a4d5-a85cefec8d36', 'article_12', 'hello, world!',
+'b29f95a2-499a-4079-97f5-ff55c3854fcb'),
+('e095e3a2-5b8e-4bc8-b793-bc3606c4fdd5', 'article_21', 'why so serious?',
+'b6dede74-ad09-4bb7-a036-997ab3ab3130')
+ON CONFLICT (id) DO NOTHING;
@@ -2,51 +2,22 @@ package main
 
 import (
 	"context"
+	"embed"
 	"errors"
 	"fmt"
+	"io/fs"
+	"time"
 
+	"github.com/Deny7676yar/observability/pkg/dbmetrics"
+	"github.com/Deny7676yar/observability/pkg/migrate"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4/pgxpool"
-	"github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/log"
+	"github.com/jackc/pgx/v4/stdlib"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	DDL = `
-DROP TABLE IF EXISTS articles;
-DROP TABLE IF EXISTS users;
-CREATE TABLE IF NOT EXISTS users
-(
-id uuid NOT NULL
-CONSTRAINT users_pk
-PRIMARY KEY,
-name varchar(150) NOT NULL
-);
-CREATE TABLE IF NOT EXISTS articles
-(
-id uuid NOT NULL
-CONSTRAINT articles_pk
-PRIMARY KEY,
-title varchar(150) NOT NULL,
-text text NOT NULL,
-user_id uuid
-CONSTRAINT articles_users_id_fk
-REFERENCES users
-);
-INSERT INTO public.users (id, name) VALUES
-('b29f95a2-499a-4079-97f5-ff55c3854fcb', 'usr1');
-INSERT INTO public.users (id, name) VALUES
-('b6dede74-ad09-4bb7-a036-997ab3ab3130', 'usr2');
-INSERT INTO public.articles (id, title, text, user_id) VALUES
-('e4e12c87-88d8-413c-8ab6-57bfa4e953a8', 'article_11', 'some text',
-'b29f95a2-499a-4079-97f5-ff55c3854fcb');
-INSERT INTO public.articles (id, title, text, user_id) VALUES
-('68792339-715c-4823-a4d5-a85cefec8d36', 'article_12', 'hello, world!',
-'b29f95a2-499a-4079-97f5-ff55c3854fcb');
-INSERT INTO public.articles (id, title, text, user_id) VALUES
-('e095e3a2-5b8e-4bc8-b793-bc3606c4fdd5', 'article_21', 'why so serious?',
-'b6dede74-ad09-4bb7-a036-997ab3ab3130');
-`
 	UsersSelect        = `SELECT id, name FROM users`
 	UserByIDSelect     = `SELECT id, name FROM users WHERE id = $1`
 	UserArticlesSelect = `SELECT id, title, text, user_id FROM articles WHERE user_id
@@ -58,26 +29,46 @@ var (
 	ErrMultipleFound = errors.New("multiple found")
 )
 
+// Repository - запросы к БД. Спаны запросов создаёт pgxtrace.Logger пула, здесь
+// трейсится только применение миграций.
 type Repository struct {
-	pool   *pgxpool.Pool
-	tracer opentracing.Tracer
+	pool    *pgxpool.Pool
+	tracer  trace.Tracer
+	metrics *dbmetrics.Collector
 }
 
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// InitSchema - применяет недостающие миграции из migrations/.
+// Данные между запусками сохраняются, миграции идут под advisory lock.
 func (r *Repository) InitSchema(ctx context.Context) error {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer,
-		"Repository.InitSchema")
-	defer span.Finish()
-	_, err := r.pool.Exec(ctx, DDL)
+	ctx, span := r.tracer.Start(ctx, "Repository.InitSchema")
+	defer span.End()
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return err
+	}
+	db := stdlib.OpenDB(*r.pool.Config().ConnConfig)
+	defer db.Close()
+	m, err := migrate.New(db, fsys, migrate.DefaultTable)
+	if err != nil {
+		return err
+	}
+	applied, err := m.Up(ctx)
+	for _, mg := range applied {
+		span.AddEvent("migration applied", trace.WithAttributes(
+			attribute.Int64("migration.version", mg.Version),
+			attribute.String("migration.name", mg.Name),
+		))
+	}
+	if err != nil {
+		spanError(span, err)
+	}
 	return err
 }
-func (r *Repository) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer,
-		"Repository.GetUser")
-	defer span.Finish()
-	span.LogFields(
-		log.String("query", UsersSelect),
-		log.String("arg0", id.String()),
-	)
+func (r *Repository) GetUser(ctx context.Context, id uuid.UUID) (_ *User, err error) {
+	defer r.metrics.Observe("GetUser", time.Now(), &err)
 	rows, _ := r.pool.Query(ctx, UserByIDSelect, id)
 	var (
 		user  User
@@ -101,12 +92,8 @@ func (r *Repository) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
 	return &user, nil
 }
 
-func (r *Repository) GetUsers(ctx context.Context) ([]User, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "Repository.GetUsers")
-	defer span.Finish()
-	span.LogFields(
-		log.String("query", UsersSelect),
-	)
+func (r *Repository) GetUsers(ctx context.Context) (_ []User, err error) {
+	defer r.metrics.Observe("GetUsers", time.Now(), &err)
 	rows, _ := r.pool.Query(ctx, UsersSelect)
 	ret := make([]User, 0)
 	for rows.Next() {
@@ -121,14 +108,8 @@ func (r *Repository) GetUsers(ctx context.Context) ([]User, error) {
 	}
 	return ret, nil
 }
-func (r *Repository) GetUserArticles(ctx context.Context, userID uuid.UUID) ([]Article, error) {
-	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer,
-		"Repository.GetUserArticles")
-	defer span.Finish()
-	span.LogFields(
-		log.String("query", UserArticlesSelect),
-		log.String("arg0", userID.String()),
-	)
+func (r *Repository) GetUserArticles(ctx context.Context, userID uuid.UUID) (_ []Article, err error) {
+	defer r.metrics.Observe("GetUserArticles", time.Now(), &err)
 	rows, _ := r.pool.Query(ctx, UserArticlesSelect, userID)
 	ret := make([]Article, 0)
 	for rows.Next() {
@@ -144,6 +125,7 @@ func (r *Repository) GetUserArticles(ctx context.Context, userID uuid.UUID) ([]A
 	}
 	return ret, nil
 }
-func NewRepository(pool *pgxpool.Pool, tracer opentracing.Tracer) *Repository {
-	return &Repository{pool: pool, tracer: tracer}
+
+func NewRepository(pool *pgxpool.Pool, tracer trace.Tracer, metrics *dbmetrics.Collector) *Repository {
+	return &Repository{pool: pool, tracer: tracer, metrics: metrics}
 }
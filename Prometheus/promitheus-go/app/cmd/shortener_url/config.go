@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/usecase/app/repo"
+	"github.com/Deny7676yar/observability/pkg/ecslog"
+	"github.com/Deny7676yar/observability/pkg/sentryreport"
+)
+
+// Config - настройки сервиса, загружаются config.FromEnv.
+type Config struct {
+	// APIAddr - адрес API, если не задан - ":"+Port или defaultAPIAddr.
+	APIAddr string `json:"api_addr" env:"API_ADDR"`
+	// Port - порт API в прежнем формате переменной PORT, используется, если API_ADDR не задан.
+	Port        string `json:"port" env:"PORT"`
+	MetricsAddr string `json:"metrics_addr" env:"METRICS_ADDR" default:":9102"`
+	// DrainDelay - сколько /readyz отвечает 503 перед остановкой серверов.
+	DrainDelay time.Duration `json:"drain_delay" env:"DRAIN_DELAY" default:"5s"`
+	// LinkStore - "pg" или "memory".
+	LinkStore   string              `json:"link_store" env:"LINK_STORE" default:"pg"`
+	DatabaseURL string              `json:"database_url" env:"DATABASE_URL"`
+	ShortCode   ShortCodeConfig     `json:"short_code"`
+	Sentry      sentryreport.Config `json:"sentry"`
+	Log         ecslog.Config       `json:"log"`
+}
+
+// ShortCodeConfig - параметры генерации коротких кодов, пустой алфавит - алфавит по умолчанию.
+type ShortCodeConfig struct {
+	Length   int    `json:"length" env:"SHORT_CODE_LENGTH" default:"5"`
+	Alphabet string `json:"alphabet" env:"SHORT_CODE_ALPHABET"`
+}
+
+const defaultAPIAddr = ":8000"
+
+// Validate вызывается config.Load после заполнения полей.
+func (c *Config) Validate() error {
+	if c.APIAddr == "" {
+		c.APIAddr = defaultAPIAddr
+		if c.Port != "" {
+			c.APIAddr = ":" + c.Port
+		}
+	}
+	switch c.LinkStore {
+	case "memory":
+	case "pg":
+		if c.DatabaseURL == "" {
+			return errors.New("database_url (env DATABASE_URL) is required for link_store pg")
+		}
+	default:
+		return errors.New(`link_store must be "pg" or "memory"`)
+	}
+	return c.shortCode().Validate()
+}
+
+func (c *Config) shortCode() repo.ShortCodeConfig {
+	sc := repo.DefaultShortCodeConfig()
+	sc.Length = c.ShortCode.Length
+	if c.ShortCode.Alphabet != "" {
+		sc.Alphabet = c.ShortCode.Alphabet
+	}
+	return sc
+}
@@ -4,71 +4,189 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/infrastructure/api/handler"
 	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/infrastructure/api/routergin"
+	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/infrastructure/db/memory"
 	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/infrastructure/db/pgstore"
 	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/infrastructure/server"
 	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/usecase/app/repo"
+	"github.com/Deny7676yar/observability/pkg/config"
+	"github.com/Deny7676yar/observability/pkg/ecslog"
+	"github.com/Deny7676yar/observability/pkg/health"
+	"github.com/Deny7676yar/observability/pkg/httpmetrics"
+	"github.com/Deny7676yar/observability/pkg/lifecycle"
+	"github.com/Deny7676yar/observability/pkg/logctx"
+	"github.com/Deny7676yar/observability/pkg/loglevel"
+	"github.com/Deny7676yar/observability/pkg/migrate"
+	"github.com/Deny7676yar/observability/pkg/recovery"
+	"github.com/Deny7676yar/observability/pkg/recovery/recoverygin"
+	"github.com/Deny7676yar/observability/pkg/requestid/requestidgin"
+	"github.com/Deny7676yar/observability/pkg/sentryreport"
+	"github.com/Deny7676yar/observability/pkg/sentryreport/sentryreportgin"
+	"github.com/getsentry/sentry-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	log "github.com/sirupsen/logrus"
 )
 
+// serviceName - имя сервиса в логах и событиях Sentry.
+const serviceName = "shortener"
+
+// linkStore - хранилище ссылок, которое нужно закрыть при остановке сервиса.
+type linkStore interface {
+	repo.LinkeStore
+	Close()
+	Ping(ctx context.Context) error
+}
+
+// newLinkStore выбирает хранилище по имени: "memory" - в памяти процесса, "pg" - Postgres.
+// Для Postgres перед стартом применяются недостающие миграции.
+func newLinkStore(ctx context.Context, kind, dsn string, reg prometheus.Registerer) (linkStore, error) {
+	switch kind {
+	case "memory":
+		return memory.NewLinks(), nil
+	case "pg":
+		lst, err := pgstore.NewLinks(dsn)
+		if err != nil {
+			return nil, err
+		}
+		m, err := lst.Migrator()
+		if err == nil {
+			var applied []migrate.Migration
+			applied, err = m.Up(ctx)
+			for _, mg := range applied {
+				log.WithFields(log.Fields{
+					"version": mg.Version,
+					"name":    mg.Name,
+				}).Info("migration applied")
+			}
+		}
+		if err != nil {
+			lst.Close()
+			return nil, fmt.Errorf("migrate link store: %w", err)
+		}
+		if err := lst.Instrument(reg, server.Namespace); err != nil {
+			lst.Close()
+			return nil, fmt.Errorf("instrument link store: %w", err)
+		}
+		return lst, nil
+	default:
+		return nil, fmt.Errorf("unknown link store %q", kind)
+	}
+}
+
+// runMigrate - подкоманда "shortener_url migrate up|down|status".
+func runMigrate(ctx context.Context, dsn string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s migrate up|down|status", os.Args[0])
+	}
+	lst, err := pgstore.NewLinks(dsn)
+	if err != nil {
+		return err
+	}
+	defer lst.Close()
+	m, err := lst.Migrator()
+	if err != nil {
+		return err
+	}
+	return migrate.Run(ctx, m, args[0], os.Stdout)
+}
+
 func main() {
-	log.SetFormatter(&log.JSONFormatter{})
+	log.AddHook(logctx.LogrusHook{}) // trace_id, span_id и request_id в записях log.WithContext(ctx)
 
-	log.SetOutput(os.Stdout)
-	log.SetLevel(log.DebugLevel)
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	var cfg Config
+	if err := config.FromEnv(&cfg); err != nil {
+		log.Fatal(err)
+	}
+	// Логи в формате ECS (pkg/ecslog): stdout или файл с ротацией, который читает Fluent Bit.
+	if err := ecslog.SetupLogrus(log.StandardLogger(), cfg.Log, serviceName); err != nil {
+		log.Fatal(err)
+	}
+	// Уровень меняется на ходу через /debug/loglevel служебного порта, изменения пишутся в лог.
+	levels, err := loglevel.New(cfg.Log.Level)
+	if err != nil {
+		log.Fatal(err)
+	}
+	levels.Logrus(log.StandardLogger())
+	log.WithFields(log.Fields(config.Redacted(&cfg))).Info("config loaded")
 
-	//ust := memory.NewLinks()
-	//ust, err := userfilemanager.NewUsers("./data.json", "mem://userRefreshTopic")
-	lst, err := pgstore.NewLinks(os.Getenv("DATABASE_URL"))
+	// Sentry: паники обработчиков и записи лога уровня error
+	hub, err := sentryreport.NewHub(cfg.Sentry, serviceName)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer hub.Flush(sentryreport.FlushTimeout)
+	log.AddHook(sentryreport.LogrusHook{Hub: hub})
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(ctx, cfg.DatabaseURL, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := run(ctx, cfg, hub, levels); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("shortener stopped with error")
+	}
+	log.Info("shortener stopped")
+}
+
+// run собирает сервис и блокируется до остановки по сигналу или падения одного из серверов.
+func run(ctx context.Context, cfg Config, hub *sentry.Hub, levels *loglevel.Levels) error {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	lst, err := newLinkStore(ctx, cfg.LinkStore, cfg.DatabaseURL, reg)
+	if err != nil {
+		return err
+	}
+	defer lst.Close()
 
-	us := repo.NewLinks(lst)
+	us := repo.NewLinks(lst, cfg.shortCode())
 	hs := handler.NewHandlers(us)
+	hm, err := httpmetrics.New(reg, server.Namespace)
+	if err != nil {
+		return err
+	}
+	rc, err := recovery.New(reg, server.Namespace)
+	if err != nil {
+		return err
+	}
 	// h := defmux.NewRouter(hs)
-	h := routergin.NewRouterGin(hs)
+	h := routergin.NewRouterGin(hs, hm.Gin(), requestidgin.Middleware(),
+		recoverygin.Middleware(rc, log.StandardLogger()), sentryreportgin.Middleware(hub))
 	//h := routeropenapi.NewRouterOpenAPI(hs)
-	srv := server.NewServer(":"+os.Getenv("PORT"), h)
 
 	a := server.App{}
-	if err := a.Init(); err != nil {
-		log.WithFields(log.Fields{
-			"Init metrics": time.Now(),
-		}).Fatal()
-	}
-	if err := a.Serve(); err != nil {
-		log.WithFields(log.Fields{
-			"Server start prometheus": time.Now(),
-		}).Info()
+	if err := a.Init(reg); err != nil {
+		return fmt.Errorf("init metrics: %w", err)
 	}
 
-	srv.Start(us)
+	hc := health.New(cfg.DrainDelay)
+	hc.Add("link_store", 0, lst.Ping)
+
+	lc := lifecycle.New(lifecycle.DefaultShutdownTimeout)
+	lc.OnShutdown(hc.Drain)
+	lc.Add("api", server.NewServer(cfg.APIAddr, h))
+	lc.Add("metrics", server.NewServer(cfg.MetricsAddr, a.Handler(reg, hc, levels)))
+
 	log.WithFields(log.Fields{
-		"Start": time.Now(),
-	}).Info()
-
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT)
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-sigCh:
-			log.WithFields(log.Fields{
-				"SIGINT": <-sigCh,
-			}).Info("cencel context")
-			srv.Stop()
-			cancel() //Если пришёл сигнал SigInt - завершаем контекст
-			lst.Close()
-		}
-	}
+		"api":     cfg.APIAddr,
+		"metrics": cfg.MetricsAddr,
+	}).Info("shortener started")
+	return lc.Run(ctx)
 }
@@ -0,0 +1,52 @@
+package linkentity
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SearchOrder - порядок выдачи результатов поиска.
+type SearchOrder string
+
+const (
+	// OrderRank - сначала самые посещаемые, при равном rank - новые.
+	OrderRank SearchOrder = "rank"
+	// OrderCreated - сначала новые.
+	OrderCreated SearchOrder = "created"
+)
+
+// SearchCursor - ключ сортировки последней выданной ссылки, следующая страница начинается после него.
+type SearchCursor struct {
+	Rank   int
+	LinkAt time.Time
+	LinkID uuid.UUID
+}
+
+// CursorOf - ключ сортировки ссылки.
+func CursorOf(l Link) SearchCursor {
+	return SearchCursor{Rank: l.Rank, LinkAt: l.LinkAt, LinkID: l.LinkID}
+}
+
+// Before сообщает, идёт ли a раньше b в выдаче с порядком o.
+// Все ключи убывают, LinkID делает порядок строгим.
+func (o SearchOrder) Before(a, b SearchCursor) bool {
+	if o == OrderRank && a.Rank != b.Rank {
+		return a.Rank > b.Rank
+	}
+	if !a.LinkAt.Equal(b.LinkAt) {
+		return a.LinkAt.After(b.LinkAt)
+	}
+	return bytes.Compare(a.LinkID[:], b.LinkID[:]) > 0
+}
+
+// SearchParams - запрос страницы поиска к хранилищу.
+// Ищется подстрока Query в OriginLink или ResultLink без учёта регистра.
+type SearchParams struct {
+	Query string
+	Order SearchOrder
+	// After - nil для первой страницы.
+	After *SearchCursor
+	Limit int
+}
@@ -31,6 +31,12 @@ type Link struct {
 	Rank       int       `json:"rank"`
 }
 
+var (
+	ErrBadAlias   = errors.New("bad custom alias")
+	ErrAliasTaken = errors.New("custom alias already taken")
+)
+
+// CreateLink - создание короткой ссылки, в ResultLink можно передать свой алиас.
 func (rt *Handlers) CreateLink(ctx context.Context, l Link) (Link, error) {
 	// DTO
 	bu := linkentity.Link{
@@ -40,6 +46,12 @@ func (rt *Handlers) CreateLink(ctx context.Context, l Link) (Link, error) {
 
 	nbu, err := rt.ls.Create(ctx, bu)
 	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrInvalidAlias):
+			return Link{}, fmt.Errorf("%w: %v", ErrBadAlias, err)
+		case errors.Is(err, repo.ErrShortCodeTaken) && l.ResultLink != "":
+			return Link{}, ErrAliasTaken
+		}
 		return Link{}, fmt.Errorf("error when creating: %w", err)
 	}
 
@@ -98,46 +110,68 @@ func (rt *Handlers) DeleteLink(ctx context.Context, uid uuid.UUID) (Link, error)
 	}, nil
 }
 
-// /search?q=...
-func (rt *Handlers) SearchLink(ctx context.Context, q string, f func(Link) error) error {
-	ch, err := rt.ls.SearchLinks(ctx, q)
+// SearchRequest - параметры /search/:q.
+type SearchRequest struct {
+	Query  string
+	Order  string
+	Cursor string
+	Limit  int
+}
+
+// ErrBadSearch - ошибка в параметрах поиска, текст ошибки можно показать клиенту.
+var ErrBadSearch = repo.ErrBadSearch
+
+// SearchLink передаёт найденные ссылки в f по одной и возвращает курсор следующей страницы
+// ("" - страница последняя). Если f вернула ошибку, поиск прекращается.
+func (rt *Handlers) SearchLink(ctx context.Context, req SearchRequest, f func(Link) error) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s, err := rt.ls.SearchLinks(ctx, repo.SearchRequest{
+		Query:  req.Query,
+		Order:  req.Order,
+		Cursor: req.Cursor,
+		Limit:  req.Limit,
+	})
 	if err != nil {
-		return fmt.Errorf("error when reading: %w", err)
+		if errors.Is(err, ErrBadSearch) {
+			return "", err
+		}
+		return "", fmt.Errorf("error when searching: %w", err)
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case l, ok := <-ch:
-			if !ok {
-				return nil
-			}
-			if err := f(Link{
-				LinkID:     l.LinkID,
-				OriginLink: l.OriginLink,
-				ResultLink: l.ResultLink,
-				LinkAt:     l.LinkAt,
-				Rank:       l.Rank,
-			}); err != nil {
-				return err
-			}
+	for l := range s.Links {
+		if err := f(Link{
+			LinkID:     l.LinkID,
+			OriginLink: l.OriginLink,
+			ResultLink: l.ResultLink,
+			LinkAt:     l.LinkAt,
+			Rank:       l.Rank,
+		}); err != nil {
+			return "", err
 		}
 	}
+	next, err := s.Wait()
+	if err != nil {
+		return "", fmt.Errorf("error when searching: %w", err)
+	}
+	return next, nil
 }
 
-// /visitor?shortURL=...
+var ErrLinkNotFound = errors.New("link not found")
+
+// /{shortCode}
 func (rt *Handlers) GetLongURL(ctx context.Context, sh string) (string, error) {
+	if sh == "" {
+		return "", fmt.Errorf("GetLongURL, bad request: short code is empty") //nolint
+	}
+
 	longURL, err := rt.ls.GetLongURL(ctx, sh)
 	if err != nil {
-		return "", err
-	}
-	for {
-		select {
-		case <-ctx.Done():
-			return "", err
-		default:
-			return longURL, nil
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrLinkNotFound
 		}
+		return "", fmt.Errorf("error when resolving: %w", err)
 	}
+	return longURL, nil
 }
@@ -1,13 +1,15 @@
 package routergin
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/infrastructure/api/handler"
 	"github.com/gin-gonic/gin"
-	"github.com/gin-gonic/gin/render"
 	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
 )
 
 type RouterGin struct {
@@ -15,8 +17,13 @@ type RouterGin struct {
 	hs *handler.Handlers
 }
 
-func NewRouterGin(hs *handler.Handlers) *RouterGin {
-	r := gin.Default()
+// NewRouterGin - роутер API, mws подключаются ко всем маршрутам после логгера запросов.
+// Recovery не подключается: его передают в mws после middleware метрик, иначе запрос
+// с паникой попадёт в метрики с кодом 200.
+func NewRouterGin(hs *handler.Handlers, mws ...gin.HandlerFunc) *RouterGin {
+	r := gin.New()
+	r.Use(gin.Logger())
+	r.Use(mws...)
 	ret := &RouterGin{
 		hs: hs,
 	}
@@ -26,7 +33,7 @@ func NewRouterGin(hs *handler.Handlers) *RouterGin {
 	r.DELETE("/delete/:id", ret.DeleteLink)
 	r.GET("/search/:q", ret.SearchLink)
 
-	r.GET("/visitors", ret.GetLongURL)
+	r.GET("/:shortCode", ret.GetLongURL)
 
 	ret.Engine = r
 	return ret
@@ -43,7 +50,14 @@ func (rt *RouterGin) CreateLink(c *gin.Context) {
 
 	l, err := rt.hs.CreateLink(c.Request.Context(), handler.Link(ru))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch {
+		case errors.Is(err, handler.ErrBadAlias):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, handler.ErrAliasTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			internalError(c, "create link failed", err)
+		}
 		return
 	}
 
@@ -61,7 +75,11 @@ func (rt *RouterGin) ReadLinkRank(c *gin.Context) { //nolint
 
 	l, err := rt.hs.ReadLinkRank(c.Request.Context(), uid)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if errors.Is(err, handler.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		internalError(c, "read link failed", err)
 		return
 	}
 
@@ -79,49 +97,102 @@ func (rt *RouterGin) DeleteLink(c *gin.Context) { //nolint
 
 	l, err := rt.hs.DeleteLink(c.Request.Context(), uid)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if errors.Is(err, handler.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		internalError(c, "delete link failed", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, l)
 }
 
+// SearchLink - GET /search/:q?order=rank|created&limit=20&cursor=...
+// Ссылки отдаются потоком в {"links":[...],"next_cursor":"..."}, next_cursor пустой на последней странице.
+// Ошибка после начала ответа пишется в поле "error" вместо next_cursor.
 func (rt *RouterGin) SearchLink(c *gin.Context) {
-	q := c.Param("id")
+	req := handler.SearchRequest{
+		Query:  c.Param("q"),
+		Order:  c.Query("order"),
+		Cursor: c.Query("cursor"),
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a number"})
+			return
+		}
+		req.Limit = n
+	}
+
+	// заголовок пишем с первой ссылкой, чтобы ошибки параметров успели стать 400
 	w := c.Writer
-	fmt.Fprintln(w, "[")
-	comma := false
-	err := rt.hs.SearchLink(c.Request.Context(), q, func(u handler.Link) error {
-		if comma {
-			fmt.Fprintln(w, ",")
+	started := false
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.WriteString(`{"links":[`)
+	}
+	next, err := rt.hs.SearchLink(c.Request.Context(), req, func(l handler.Link) error {
+		b, err := json.Marshal(l)
+		if err != nil {
+			return err
+		}
+		if started {
+			_, _ = w.WriteString(",")
 		} else {
-			comma = true
+			start()
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
 		}
-		(render.JSON{Data: u}).Render(w) //nolint
 		w.Flush()
 		return nil
 	})
-	if err != nil {
-		if comma {
-			fmt.Fprint(w, ",")
+	if err != nil && !started {
+		if errors.Is(err, handler.ErrBadSearch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
-		(render.JSON{Data: err}).Render(w) //nolint
+		internalError(c, "search links failed", err)
+		return
+	}
+	if !started {
+		start()
+	}
+	tail := gin.H{"next_cursor": next}
+	if err != nil {
+		log.WithContext(c.Request.Context()).WithError(err).Error("search links failed")
+		tail = gin.H{"error": err.Error()}
 	}
-	fmt.Fprintln(w, "]")
+	b, _ := json.Marshal(tail)
+	_, _ = w.WriteString("],")
+	_, _ = w.Write(b[1:]) // без открывающей скобки: продолжаем уже начатый объект
 }
 
+// GetLongURL - переход по короткой ссылке.
+// Отвечаем 302, а не 301: постоянный редирект браузер кеширует, и повторные переходы не попадут в rank.
 func (rt *RouterGin) GetLongURL(c *gin.Context) {
-	s := c.Param("resultLink")
-
-	if err := c.ShouldBind(s); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-	}
+	s := c.Param("shortCode")
 
 	l, err := rt.hs.GetLongURL(c.Request.Context(), s)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if errors.Is(err, handler.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		internalError(c, "resolve short code failed", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, l)
+	c.Redirect(http.StatusFound, l)
+}
+
+// internalError - ответ 500. Ошибка пишется в лог с контекстом запроса, чтобы
+// logctx.LogrusHook добавил поля корреляции.
+func internalError(c *gin.Context, msg string, err error) {
+	log.WithContext(c.Request.Context()).WithError(err).Error(msg)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 }
@@ -0,0 +1,91 @@
+package routergin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/entities/linkentity"
+	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/infrastructure/api/handler"
+	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/infrastructure/db/memory"
+	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/usecase/app/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(RedirectSuite))
+
+type RedirectSuite struct {
+	st *memory.Links
+	ls *repo.Links
+	r  *RouterGin
+}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *RedirectSuite) SetUpTest(c *gc.C) {
+	gin.SetMode(gin.TestMode)
+	s.st = memory.NewLinks()
+	s.ls = repo.NewLinks(s.st, repo.DefaultShortCodeConfig())
+	s.r = NewRouterGin(handler.NewHandlers(s.ls))
+}
+
+func (s *RedirectSuite) get(path string) *httptest.ResponseRecorder {
+	return s.do(http.MethodGet, path)
+}
+
+func (s *RedirectSuite) do(method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.r.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+func (s *RedirectSuite) TestRedirect(c *gc.C) {
+	ctx := context.Background()
+	l, err := s.ls.Create(ctx, linkentity.Link{OriginLink: "https://example.com/long", ResultLink: "go-here"})
+	c.Assert(err, gc.IsNil)
+
+	rec := s.get("/go-here")
+	c.Assert(rec.Code, gc.Equals, http.StatusFound)
+	c.Assert(rec.Header().Get("Location"), gc.Equals, "https://example.com/long")
+
+	stored, err := s.st.ReadLinkRank(ctx, l.LinkID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(stored.Rank, gc.Equals, 1, gc.Commentf("redirect must be counted as a visit"))
+}
+
+func (s *RedirectSuite) TestUnknownCode(c *gc.C) {
+	rec := s.get("/nowhere")
+	c.Assert(rec.Code, gc.Equals, http.StatusNotFound)
+	c.Assert(rec.Header().Get("Location"), gc.Equals, "")
+	c.Assert(rec.Body.String(), gc.Equals, `{"error":"`+handler.ErrLinkNotFound.Error()+`"}`)
+}
+
+func (s *RedirectSuite) TestDeletedLink(c *gc.C) {
+	ctx := context.Background()
+	l, err := s.ls.Create(ctx, linkentity.Link{OriginLink: "https://example.com/gone", ResultLink: "gone"})
+	c.Assert(err, gc.IsNil)
+	_, err = s.ls.Delete(ctx, l.LinkID)
+	c.Assert(err, gc.IsNil)
+
+	rec := s.get("/gone")
+	c.Assert(rec.Code, gc.Equals, http.StatusNotFound)
+	c.Assert(rec.Header().Get("Location"), gc.Equals, "")
+}
+
+func (s *RedirectSuite) TestReadAndDeleteMissingLink(c *gc.C) {
+	id := uuid.New().String()
+	notFound := `{"error":"` + handler.ErrUserNotFound.Error() + `"}`
+
+	rec := s.get("/read/" + id)
+	c.Assert(rec.Code, gc.Equals, http.StatusNotFound)
+	c.Assert(rec.Body.String(), gc.Equals, notFound)
+
+	rec = s.do(http.MethodDelete, "/delete/"+id)
+	c.Assert(rec.Code, gc.Equals, http.StatusNotFound)
+	c.Assert(rec.Body.String(), gc.Equals, notFound)
+}
@@ -0,0 +1,207 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/entities/linkentity"
+	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/usecase/app/repo"
+	"github.com/google/uuid"
+)
+
+var _ repo.LinkeStore = &Links{}
+
+type memLink struct {
+	linkentity.Link
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+}
+
+// Links - потокобезопасное хранилище ссылок в памяти процесса.
+// Повторяет поведение pgstore.Links: удаление мягкое, удалённые ссылки не ищутся и не читаются.
+type Links struct {
+	mu sync.RWMutex
+	m  map[uuid.UUID]*memLink
+	// byCode - индекс по короткому коду, как уникальный индекс на resultLink в pgstore.
+	// Удалённые ссылки код не освобождают.
+	byCode map[string]uuid.UUID
+}
+
+func NewLinks() *Links {
+	return &Links{
+		m:      make(map[uuid.UUID]*memLink),
+		byCode: make(map[string]uuid.UUID),
+	}
+}
+
+// Close - нужен для совместимости с pgstore.Links, ресурсов не держит.
+func (ls *Links) Close() {}
+
+// Ping - хранилище в памяти всегда доступно.
+func (ls *Links) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (ls *Links) Create(ctx context.Context, l linkentity.Link) (*uuid.UUID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if l.LinkID == uuid.Nil {
+		l.LinkID = uuid.New()
+	}
+	now := time.Now()
+	// как и pgstore.Links: пустой LinkAt - время записи, в том числе при повторном Create
+	if l.LinkAt.IsZero() {
+		l.LinkAt = now
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if l.ResultLink != "" {
+		if owner, ok := ls.byCode[l.ResultLink]; ok && owner != l.LinkID {
+			return nil, repo.ErrShortCodeTaken
+		}
+	}
+	if ml, ok := ls.m[l.LinkID]; ok {
+		if ml.ResultLink != l.ResultLink {
+			delete(ls.byCode, ml.ResultLink)
+		}
+		ls.index(l)
+		ml.OriginLink = l.OriginLink
+		ml.ResultLink = l.ResultLink
+		ml.LinkAt = l.LinkAt
+		ml.UpdatedAt = now
+		ml.DeletedAt = nil
+		return &l.LinkID, nil
+	}
+	ls.index(l)
+	ls.m[l.LinkID] = &memLink{
+		Link:      l,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return &l.LinkID, nil
+}
+
+// index добавляет код ссылки в индекс, вызывается под ls.mu.
+func (ls *Links) index(l linkentity.Link) {
+	if l.ResultLink != "" {
+		ls.byCode[l.ResultLink] = l.LinkID
+	}
+}
+
+func (ls *Links) ReadLinkRank(ctx context.Context, uid uuid.UUID) (*linkentity.Link, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	ml, ok := ls.m[uid]
+	if !ok || ml.DeletedAt != nil {
+		return nil, sql.ErrNoRows
+	}
+	l := ml.Link
+	return &l, nil
+}
+
+func (ls *Links) Delete(ctx context.Context, uid uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	ml, ok := ls.m[uid]
+	if !ok || ml.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	ml.DeletedAt = &now
+	ml.UpdatedAt = now
+	return nil
+}
+
+// SearchLinks - страница поиска, порядок и курсор те же, что у pgstore.
+func (ls *Links) SearchLinks(ctx context.Context, p linkentity.SearchParams) (chan linkentity.Link, chan error) {
+	const buf = 100
+
+	// Снимок берём под блокировкой, а отдаём в канал уже без неё,
+	// чтобы медленный читатель не блокировал запись.
+	q := strings.ToLower(p.Query)
+	ls.mu.RLock()
+	found := make([]linkentity.Link, 0)
+	for _, ml := range ls.m {
+		if ml.DeletedAt != nil {
+			continue
+		}
+		if p.After != nil && !p.Order.Before(*p.After, linkentity.CursorOf(ml.Link)) {
+			continue
+		}
+		if strings.Contains(strings.ToLower(ml.OriginLink), q) || strings.Contains(strings.ToLower(ml.ResultLink), q) {
+			found = append(found, ml.Link)
+		}
+	}
+	ls.mu.RUnlock()
+	sort.Slice(found, func(i, j int) bool {
+		return p.Order.Before(linkentity.CursorOf(found[i]), linkentity.CursorOf(found[j]))
+	})
+	if p.Limit > 0 && len(found) > p.Limit {
+		found = found[:p.Limit]
+	}
+
+	chout := make(chan linkentity.Link, buf)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(chout)
+		for _, l := range found {
+			select {
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			case chout <- l:
+			}
+		}
+	}()
+	return chout, errc
+}
+
+// GetLongURL - находит исходную ссылку по короткому коду и засчитывает переход.
+func (ls *Links) GetLongURL(ctx context.Context, sh string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	ml, ok := ls.m[ls.byCode[sh]]
+	if !ok || ml.DeletedAt != nil {
+		return "", sql.ErrNoRows
+	}
+	ml.Rank++
+	ml.UpdatedAt = time.Now()
+	return ml.OriginLink, nil
+}
+
+func (ls *Links) RankCounter(ctx context.Context, uid uuid.UUID, rank int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	ml, ok := ls.m[uid]
+	if !ok || ml.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+	ml.Rank = rank
+	ml.UpdatedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,22 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/test"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(MemTestSuite))
+
+type MemTestSuite struct {
+	test.SuitBase
+}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *MemTestSuite) SetUpTest(c *gc.C) {
+	s.Setlink(NewLinks())
+}
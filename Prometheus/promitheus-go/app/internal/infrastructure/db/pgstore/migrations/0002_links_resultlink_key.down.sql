@@ -0,0 +1 @@
+DROP INDEX IF EXISTS links_resultlink_key;
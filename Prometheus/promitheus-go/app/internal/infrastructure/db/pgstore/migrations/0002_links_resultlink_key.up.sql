@@ -0,0 +1,2 @@
+CREATE UNIQUE INDEX IF NOT EXISTS links_resultlink_key
+	ON links (resultLink) WHERE resultLink <> '';
@@ -3,17 +3,35 @@ package pgstore
 import (
 	"context"
 	"database/sql"
-	"log"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
 	"time"
 
 	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/entities/linkentity"
 	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/usecase/app/repo"
+	"github.com/Deny7676yar/observability/pkg/dbmetrics"
+	"github.com/Deny7676yar/observability/pkg/migrate"
 	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var _ repo.LinkeStore = &Links{}
 
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+const (
+	// resultLinkIndex - уникальный индекс на короткий код, см. migrations/0002_links_resultlink_key.up.sql.
+	resultLinkIndex = "links_resultlink_key"
+	// pgUniqueViolation - код ошибки Postgres unique_violation.
+	pgUniqueViolation = "23505"
+)
+
 type DBPgLink struct {
 	LinkID     uuid.UUID
 	CreatedAt  time.Time
@@ -26,7 +44,8 @@ type DBPgLink struct {
 }
 
 type Links struct {
-	db *sql.DB
+	db      *sql.DB
+	metrics *dbmetrics.Collector
 }
 
 func NewLinks(dsn string) (*Links, error) {
@@ -39,44 +58,73 @@ func NewLinks(dsn string) (*Links, error) {
 		db.Close()
 		return nil, err
 	}
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS links (
-		id uuid NOT NULL,
-		created_at timestamptz NOT NULL,
-		updated_at timestamptz NOT NULL,
-		deleted_at timestamptz NULL,
-		originLink varchar NOT NULL,
-		resultLink varchar NOT NULL,
-		link_at timestamptz NOT NULL,
-		rank integer,
-		CONSTRAINT links_pk PRIMARY KEY (id)
-	)`)
-	if err != nil {
-		db.Close()
-		return nil, err
-	}
 	ls := &Links{
 		db: db,
 	}
 	return ls, nil
 }
 
+// Migrations - встроенные миграции схемы хранилища.
+func Migrations() fs.FS {
+	sub, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		panic(err) // каталог встроен при сборке, ошибка здесь - ошибка программиста
+	}
+	return sub
+}
+
+// Migrator - миграции схемы для базы этого хранилища.
+func (ls *Links) Migrator() (*migrate.Migrator, error) {
+	return migrate.New(ls.db, Migrations(), migrate.DefaultTable)
+}
+
+// Instrument - включает метрики пула соединений и запросов хранилища и регистрирует их в reg.
+func (ls *Links) Instrument(reg prometheus.Registerer, namespace string) error {
+	c := dbmetrics.NewCollector(namespace, "links", dbmetrics.SQLStats(ls.db))
+	if err := reg.Register(c); err != nil {
+		return err
+	}
+	ls.metrics = c
+	return nil
+}
+
 func (ls *Links) Close() {
 	ls.db.Close()
 }
 
-func (ls *Links) Create(ctx context.Context, l linkentity.Link) (*uuid.UUID, error) {
+// Ping проверяет соединение с базой, используется в /readyz.
+func (ls *Links) Ping(ctx context.Context) error {
+	return ls.db.PingContext(ctx)
+}
+
+func (ls *Links) Create(ctx context.Context, l linkentity.Link) (_ *uuid.UUID, err error) {
+	defer ls.metrics.Observe("Create", time.Now(), &err)
+	if l.LinkID == uuid.Nil {
+		l.LinkID = uuid.New()
+	}
+	now := time.Now()
+	// как и memory.Links: явный LinkAt сохраняется, пустой - время создания
+	if l.LinkAt.IsZero() {
+		l.LinkAt = now
+	}
 	dbu := &DBPgLink{
 		LinkID:     l.LinkID,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
+		CreatedAt:  now,
+		UpdatedAt:  now,
 		OriginLink: l.OriginLink,
 		ResultLink: l.ResultLink,
-		LinkAt:     time.Now(),
+		LinkAt:     l.LinkAt,
 	}
 
-	_, err := ls.db.ExecContext(ctx, `INSERT INTO links 
+	_, err = ls.db.ExecContext(ctx, `INSERT INTO links 
 	(id, created_at, updated_at, deleted_at, originLink, resultLink, link_at, rank )
-	values ($1, $2, $3, $4, $5, $6, $7, $8)`,
+	values ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (id) DO UPDATE SET
+		updated_at = EXCLUDED.updated_at,
+		deleted_at = NULL,
+		originLink = EXCLUDED.originLink,
+		resultLink = EXCLUDED.resultLink,
+		link_at = EXCLUDED.link_at`,
 		dbu.LinkID,
 		dbu.CreatedAt,
 		dbu.UpdatedAt,
@@ -87,41 +135,52 @@ func (ls *Links) Create(ctx context.Context, l linkentity.Link) (*uuid.UUID, err
 		dbu.Rank,
 	)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation && pgErr.ConstraintName == resultLinkIndex {
+			return nil, repo.ErrShortCodeTaken
+		}
 		return nil, err
 	}
 
 	return &l.LinkID, nil
 }
 
-func (ls *Links) Delete(ctx context.Context, uid uuid.UUID) error {
-	_, err := ls.db.ExecContext(ctx, `UPDATE links SET deleted_at = $2 WHERE id = $1`,
+func (ls *Links) Delete(ctx context.Context, uid uuid.UUID) (err error) {
+	defer ls.metrics.Observe("Delete", time.Now(), &err)
+	res, err := ls.db.ExecContext(ctx, `UPDATE links SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL`,
 		uid, time.Now(),
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	// как и memory.Links: нет ссылки или она уже удалена
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-func (ls *Links) ReadLinkRank(ctx context.Context, uid uuid.UUID) (*linkentity.Link, error) {
+func (ls *Links) ReadLinkRank(ctx context.Context, uid uuid.UUID) (_ *linkentity.Link, err error) {
+	defer ls.metrics.Observe("ReadLinkRank", time.Now(), &err)
 	dbu := &DBPgLink{}
-	rows, err := ls.db.QueryContext(ctx,
+	err = ls.db.QueryRowContext(ctx,
 		`SELECT id, created_at, updated_at, deleted_at, originLink, resultLink, link_at, rank
-	FROM users WHERE id = $1`, uid)
+	FROM links WHERE id = $1 AND deleted_at IS NULL`, uid).Scan(
+		&dbu.LinkID,
+		&dbu.CreatedAt,
+		&dbu.UpdatedAt,
+		&dbu.DeletedAt,
+		&dbu.OriginLink,
+		&dbu.ResultLink,
+		&dbu.LinkAt,
+		&dbu.Rank,
+	)
 	if err != nil {
-		return nil, rows.Err()
-	}
-	defer rows.Close()
-	for rows.Next() {
-		if err := rows.Scan(
-			&dbu.LinkID,
-			&dbu.CreatedAt,
-			&dbu.UpdatedAt,
-			&dbu.DeletedAt,
-			&dbu.OriginLink,
-			&dbu.ResultLink,
-			&dbu.LinkAt,
-			&dbu.Rank,
-		); err != nil {
-			return nil, err
-		}
+		return nil, err
 	}
 
 	return &linkentity.Link{
@@ -133,58 +192,102 @@ func (ls *Links) ReadLinkRank(ctx context.Context, uid uuid.UUID) (*linkentity.L
 	}, nil
 }
 
-func (ls *Links) SearchLinks(ctx context.Context, s string) (chan linkentity.Link, error) {
+// likeEscaper экранирует спецсимволы LIKE, чтобы строка поиска искалась как есть.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// searchQuery строит запрос страницы поиска. Условие по курсору - сравнение кортежей
+// в том же порядке, что и ORDER BY, поэтому страницы не пересекаются и не теряют строки.
+func searchQuery(p linkentity.SearchParams) (string, []interface{}) {
+	args := []interface{}{"%" + likeEscaper.Replace(p.Query) + "%"}
+	q := `
+		SELECT id, originLink, resultLink, link_at, COALESCE(rank, 0)
+		FROM links
+		WHERE deleted_at IS NULL
+			AND (originLink ILIKE $1 OR resultLink ILIKE $1)`
+	order := ` ORDER BY link_at DESC, id DESC`
+	if p.Order == linkentity.OrderRank {
+		order = ` ORDER BY COALESCE(rank, 0) DESC, link_at DESC, id DESC`
+	}
+	if p.After != nil {
+		if p.Order == linkentity.OrderRank {
+			args = append(args, p.After.Rank, p.After.LinkAt, p.After.LinkID)
+			q += ` AND (COALESCE(rank, 0), link_at, id) < ($2, $3, $4)`
+		} else {
+			args = append(args, p.After.LinkAt, p.After.LinkID)
+			q += ` AND (link_at, id) < ($2, $3)`
+		}
+	}
+	q += order
+	if p.Limit > 0 {
+		args = append(args, p.Limit)
+		q += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+	return q, args
+}
+
+// SearchLinks - страница поиска. Ошибка запроса или чтения строк приходит в канал ошибок
+// после закрытия канала ссылок.
+func (ls *Links) SearchLinks(ctx context.Context, p linkentity.SearchParams) (chan linkentity.Link, chan error) {
 	const buf = 100
 	chout := make(chan linkentity.Link, buf)
+	errc := make(chan error, 1)
 
 	go func() {
+		var err error
+		defer close(errc)
+		defer func() {
+			if err != nil {
+				errc <- err
+			}
+		}()
 		defer close(chout)
-		dbu := &DBPgLink{}
+		defer ls.metrics.Observe("SearchLinks", time.Now(), &err)
 
-		rows, err := ls.db.QueryContext( //nolint
-			ctx, `
-		SELECT id, created_at, updated_at, originLink, resultLink, link_at, rank
-		FROM users WHERE name LIKE $1 and deleted_at is null`, "%"+s+"%")
-		if err != sql.ErrNoRows { //nolint
+		q, args := searchQuery(p)
+		var rows *sql.Rows
+		rows, err = ls.db.QueryContext(ctx, q, args...)
+		if err != nil {
 			return
 		}
 		defer rows.Close()
 
 		for rows.Next() {
-			if err := rows.Scan(
-				&dbu.LinkID,
-				&dbu.CreatedAt,
-				&dbu.UpdatedAt,
-				&dbu.DeletedAt,
-				&dbu.OriginLink,
-				&dbu.ResultLink,
-				&dbu.LinkAt,
-				&dbu.Rank,
-			); err != nil {
-				log.Println(err)
+			var l linkentity.Link
+			if err = rows.Scan(&l.LinkID, &l.OriginLink, &l.ResultLink, &l.LinkAt, &l.Rank); err != nil {
 				return
 			}
-
-			chout <- linkentity.Link{
-				LinkID:     dbu.LinkID,
-				OriginLink: dbu.OriginLink,
-				ResultLink: dbu.ResultLink,
-				LinkAt:     dbu.LinkAt,
-				Rank:       dbu.Rank,
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			case chout <- l:
 			}
 		}
+		err = rows.Err()
 	}()
 
-	return chout, nil
+	return chout, errc
 }
 
-//функция для удовлетворения interface
-func (ls *Links) GetLongURL(ctx context.Context, sh string) (string, error) {
-	return sh, nil
+// GetLongURL - находит исходную ссылку по короткому коду и засчитывает переход.
+// Счётчик увеличивается одним UPDATE, поэтому параллельные переходы не теряются.
+func (ls *Links) GetLongURL(ctx context.Context, sh string) (_ string, err error) {
+	defer ls.metrics.Observe("GetLongURL", time.Now(), &err)
+	var longURL string
+	err = ls.db.QueryRowContext(ctx,
+		`UPDATE links SET rank = COALESCE(rank, 0) + 1, updated_at = $2
+	WHERE resultLink = $1 AND deleted_at IS NULL
+	RETURNING originLink`, sh, time.Now(),
+	).Scan(&longURL)
+	if err != nil {
+		return "", err
+	}
+	return longURL, nil
 }
 
-func (ls *Links) RankCounter(ctx context.Context, uid uuid.UUID, rank int) error {
-	_, err := ls.db.ExecContext(ctx, `UPDATE links SET rank = $2 WHERE id = $1`,
+func (ls *Links) RankCounter(ctx context.Context, uid uuid.UUID, rank int) (err error) {
+	defer ls.metrics.Observe("RankCounter", time.Now(), &err)
+	_, err = ls.db.ExecContext(ctx, `UPDATE links SET rank = $2 WHERE id = $1`,
 		uid, rank,
 	)
 	return err
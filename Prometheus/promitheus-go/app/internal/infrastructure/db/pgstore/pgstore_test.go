@@ -1,6 +1,7 @@
 package pgstore
 
 import (
+	"context"
 	"database/sql"
 	"os"
 	"testing"
@@ -28,7 +29,12 @@ func (s *PgTestSuite) SetUpSuite(c *gc.C) {
 
 	l, err := NewLinks(dsn)
 	c.Assert(err, gc.IsNil)
+	m, err := l.Migrator()
+	c.Assert(err, gc.IsNil)
+	_, err = m.Up(context.Background())
+	c.Assert(err, gc.IsNil)
 	s.db = l.db
+	s.Setlink(l)
 }
 
 func (s *PgTestSuite) SetUpTest(c *gc.C) {
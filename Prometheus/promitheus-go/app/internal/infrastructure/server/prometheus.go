@@ -37,7 +37,7 @@ func (a *App) processHandler(w http.ResponseWriter, r *http.Request) {
 	writeResponse(w, http.StatusOK, strings.ToUpper(line))
 }
 
-func (a *App) Init() error {
+func (a *App) Init(reg prometheus.Registerer) error {
 	// prometheus type: histogram
 	a.latencyHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: Namespace,
@@ -71,10 +71,16 @@ func (a *App) Init() error {
 			Name:      "last_line_length",
 			Help:      "The length of the last received line",
 		})
-	prometheus.MustRegister(a.latencyHistogram)
-	prometheus.MustRegister(a.lineLengthHistogram)
-	prometheus.MustRegister(a.lineCounter)
-	prometheus.MustRegister(a.lastLineLengthGauge)
+	for _, c := range []prometheus.Collector{
+		a.latencyHistogram,
+		a.lineLengthHistogram,
+		a.lineCounter,
+		a.lastLineLengthGauge,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -2,6 +2,8 @@ package test
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"os"
 	"os/signal"
 	"time"
@@ -26,8 +28,9 @@ func (s *SuitBase) TestCreateLink(c *gc.C) {
 		OriginLink: "https://example.com",
 		LinkAt:     time.Now().Add(-10 * time.Hour),
 	}
-	_, err := s.l.Create(ctx, *origin)
+	id, err := s.l.Create(ctx, *origin)
 	c.Assert(err, gc.IsNil)
+	origin.LinkID = *id
 	c.Assert(origin.LinkID, gc.Not(gc.Equals), uuid.Nil, gc.Commentf(""))
 
 	accessedAt := time.Now().Truncate(time.Second).UTC()
@@ -36,8 +39,160 @@ func (s *SuitBase) TestCreateLink(c *gc.C) {
 		OriginLink: "https://example.com",
 		LinkAt:     accessedAt,
 	}
-	_, err = s.l.Create(ctx, *existing)
+	id, err = s.l.Create(ctx, *existing)
 	c.Assert(err, gc.IsNil)
+	existing.LinkID = *id
 	c.Assert(existing.LinkID, gc.Equals, origin.LinkID, gc.Commentf("link ID changed while upserting"))
+
+	_, err = s.l.Create(ctx, linkentity.Link{LinkID: origin.LinkID, OriginLink: "https://example.com"})
+	c.Assert(err, gc.IsNil)
+	l, err := s.l.ReadLinkRank(ctx, origin.LinkID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(l.LinkAt.IsZero(), gc.Equals, false, gc.Commentf("empty LinkAt is set to the write time"))
+	cancel()
+}
+
+func (s *SuitBase) TestReadAndDeleteLink(c *gc.C) {
+	ctx := context.Background()
+	id, err := s.l.Create(ctx, linkentity.Link{
+		OriginLink: "https://example.com/read",
+		ResultLink: "rDlnk",
+	})
+	c.Assert(err, gc.IsNil)
+
+	l, err := s.l.ReadLinkRank(ctx, *id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(l.OriginLink, gc.Equals, "https://example.com/read")
+	c.Assert(l.ResultLink, gc.Equals, "rDlnk")
+
+	c.Assert(s.l.Delete(ctx, *id), gc.IsNil)
+	c.Assert(s.l.Delete(ctx, *id), gc.Equals, sql.ErrNoRows, gc.Commentf("link is already deleted"))
+	c.Assert(s.l.Delete(ctx, uuid.New()), gc.Equals, sql.ErrNoRows)
+	_, err = s.l.ReadLinkRank(ctx, *id)
+	c.Assert(err, gc.Equals, sql.ErrNoRows, gc.Commentf("deleted link must not be readable"))
+	_, err = s.l.GetLongURL(ctx, "rDlnk")
+	c.Assert(err, gc.Equals, sql.ErrNoRows, gc.Commentf("deleted link must not be resolvable"))
+}
+
+// search читает страницу поиска целиком и возвращает короткие коды в порядке выдачи.
+func (s *SuitBase) search(c *gc.C, p linkentity.SearchParams) []string {
+	ch, errc := s.l.SearchLinks(context.Background(), p)
+	codes := make([]string, 0)
+	for l := range ch {
+		codes = append(codes, l.ResultLink)
+	}
+	c.Assert(<-errc, gc.IsNil)
+	return codes
+}
+
+func (s *SuitBase) TestSearchLinks(c *gc.C) {
+	ctx := context.Background()
+	for _, l := range []linkentity.Link{
+		{OriginLink: "https://golang.org/doc", ResultLink: "gOdoc"},
+		{OriginLink: "https://GoLang.org/pkg", ResultLink: "gOpkg"},
+		{OriginLink: "https://example.com", ResultLink: "eXmpl"},
+		{OriginLink: "https://example.com/100%_off", ResultLink: "sAle1"},
+	} {
+		_, err := s.l.Create(ctx, l)
+		c.Assert(err, gc.IsNil)
+	}
+
+	found := s.search(c, linkentity.SearchParams{Query: "golang", Order: linkentity.OrderCreated})
+	c.Assert(found, gc.HasLen, 2)
+	c.Assert(s.search(c, linkentity.SearchParams{Query: "xmp", Order: linkentity.OrderCreated}), gc.DeepEquals, []string{"eXmpl"})
+	// спецсимволы LIKE ищутся как обычные символы
+	c.Assert(s.search(c, linkentity.SearchParams{Query: "%_", Order: linkentity.OrderCreated}), gc.DeepEquals, []string{"sAle1"})
+	c.Assert(s.search(c, linkentity.SearchParams{Query: "_", Order: linkentity.OrderCreated}), gc.DeepEquals, []string{"sAle1"})
+}
+
+func (s *SuitBase) TestSearchLinksOrderAndPages(c *gc.C) {
+	ctx := context.Background()
+	base := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	// rank: pAge1=0, pAge2=3, pAge3=3, pAge4=1; создаются по порядку через час
+	ranks := []int{0, 3, 3, 1}
+	for i, r := range ranks {
+		id, err := s.l.Create(ctx, linkentity.Link{
+			OriginLink: "https://example.com/page",
+			ResultLink: "pAge" + string(rune('1'+i)),
+			LinkAt:     base.Add(time.Duration(i) * time.Hour),
+		})
+		c.Assert(err, gc.IsNil)
+		c.Assert(s.l.RankCounter(ctx, *id, r), gc.IsNil)
+	}
+
+	c.Assert(s.search(c, linkentity.SearchParams{Query: "page", Order: linkentity.OrderCreated}),
+		gc.DeepEquals, []string{"pAge4", "pAge3", "pAge2", "pAge1"})
+	c.Assert(s.search(c, linkentity.SearchParams{Query: "page", Order: linkentity.OrderRank}),
+		gc.DeepEquals, []string{"pAge3", "pAge2", "pAge4", "pAge1"})
+
+	for _, order := range []linkentity.SearchOrder{linkentity.OrderRank, linkentity.OrderCreated} {
+		p := linkentity.SearchParams{Query: "page", Order: order, Limit: 3}
+		all := s.search(c, linkentity.SearchParams{Query: "page", Order: order})
+		got := make([]string, 0)
+		for page := 0; page < 3; page++ {
+			ch, errc := s.l.SearchLinks(ctx, p)
+			var last *linkentity.Link
+			for l := range ch {
+				l := l
+				got = append(got, l.ResultLink)
+				last = &l
+			}
+			c.Assert(<-errc, gc.IsNil)
+			if last == nil {
+				break
+			}
+			cur := linkentity.CursorOf(*last)
+			p.After = &cur
+		}
+		c.Assert(got, gc.DeepEquals, all, gc.Commentf("order %s", order))
+	}
+}
+
+func (s *SuitBase) TestSearchLinksCancelled(c *gc.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	for i := 0; i < 300; i++ {
+		_, err := s.l.Create(ctx, linkentity.Link{OriginLink: "https://example.com/many", ResultLink: uuid.NewString()[:8]})
+		c.Assert(err, gc.IsNil)
+	}
+	ch, errc := s.l.SearchLinks(ctx, linkentity.SearchParams{Query: "many", Order: linkentity.OrderCreated})
+	<-ch
 	cancel()
+	for range ch {
+	}
+	c.Assert(errors.Is(<-errc, context.Canceled), gc.Equals, true)
+}
+
+func (s *SuitBase) TestGetLongURLAndRank(c *gc.C) {
+	ctx := context.Background()
+	id, err := s.l.Create(ctx, linkentity.Link{
+		OriginLink: "https://example.com/long",
+		ResultLink: "lOngu",
+	})
+	c.Assert(err, gc.IsNil)
+
+	for i := 0; i < 2; i++ {
+		long, err := s.l.GetLongURL(ctx, "lOngu")
+		c.Assert(err, gc.IsNil)
+		c.Assert(long, gc.Equals, "https://example.com/long")
+	}
+	l, err := s.l.ReadLinkRank(ctx, *id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(l.Rank, gc.Equals, 2, gc.Commentf("every resolve must be counted as a visit"))
+
+	c.Assert(s.l.RankCounter(ctx, *id, 5), gc.IsNil)
+	l, err = s.l.ReadLinkRank(ctx, *id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(l.Rank, gc.Equals, 5)
+
+	_, err = s.l.GetLongURL(ctx, "nOtfd")
+	c.Assert(err, gc.Equals, sql.ErrNoRows)
+}
+
+func (s *SuitBase) TestCreateDuplicateShortCode(c *gc.C) {
+	ctx := context.Background()
+	_, err := s.l.Create(ctx, linkentity.Link{OriginLink: "https://example.com/a", ResultLink: "dUpld"})
+	c.Assert(err, gc.IsNil)
+
+	_, err = s.l.Create(ctx, linkentity.Link{OriginLink: "https://example.com/b", ResultLink: "dUpld"})
+	c.Assert(errors.Is(err, repo.ErrShortCodeTaken), gc.Equals, true, gc.Commentf("got %v", err))
 }
@@ -2,77 +2,81 @@ package repo
 
 import (
 	"context"
-	"crypto/rand"
+	"errors"
 	"fmt"
-	"math/big"
-	"sync"
-	"unicode"
+	"time"
 
 	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/entities/linkentity"
 	"github.com/google/uuid"
-
-	log "github.com/sirupsen/logrus"
 )
 
 type LinkeStore interface {
+	// Create сохраняет ссылку (или обновляет существующую с тем же LinkID).
+	// Если ResultLink уже занят другой ссылкой, возвращает ErrShortCodeTaken.
 	Create(ctx context.Context, l linkentity.Link) (*uuid.UUID, error)
 	ReadLinkRank(ctx context.Context, uid uuid.UUID) (*linkentity.Link, error)
 	Delete(ctx context.Context, uid uuid.UUID) error
-	SearchLinks(ctx context.Context, s string) (chan linkentity.Link, error)
+	// SearchLinks отдаёт страницу поиска в канал ссылок. Канал ошибок получает не больше одной ошибки
+	// и закрывается после канала ссылок.
+	SearchLinks(ctx context.Context, p linkentity.SearchParams) (chan linkentity.Link, chan error)
+	// GetLongURL возвращает исходную ссылку по короткому коду и атомарно увеличивает её rank.
+	// Для неизвестного или удалённого кода возвращает sql.ErrNoRows.
 	GetLongURL(ctx context.Context, sh string) (string, error)
 	RankCounter(ctx context.Context, uid uuid.UUID, rank int) error
 }
 
-const (
-	lenghtURL = 5
-	buf       = 100
-)
+const buf = 100
 
 type Links struct {
 	lstore LinkeStore
-	mu     sync.Mutex
+	sc     ShortCodeConfig
 }
 
-func NewLinks(lstore LinkeStore) *Links {
+func NewLinks(lstore LinkeStore, sc ShortCodeConfig) *Links {
 	return &Links{
 		lstore: lstore,
+		sc:     sc.withDefaults(),
 	}
 }
 
-//Create - создание ссылки в виде json
+// Create - создание ссылки в виде json.
+// Если ResultLink задан, он используется как пользовательский алиас, иначе код генерируется.
+// Код выбирается до записи в хранилище, при коллизии сгенерированного кода пробуем новый.
 func (ls *Links) Create(ctx context.Context, l linkentity.Link) (*linkentity.Link, error) {
 	//linkentity.Link - определяется на слое entites
-	var err error
-	csl, err := createShortURL()
-	if err != nil {
-		return nil, fmt.Errorf("create link error: %w", err)
-	}
-
 	l.LinkID = uuid.New()
-	id, err := ls.lstore.Create(ctx, l)
-	if err != nil {
-		return nil, fmt.Errorf("create link error: %w", err)
+	if l.LinkAt.IsZero() {
+		l.LinkAt = time.Now()
 	}
 
-	l.LinkID = *id
-	l.ResultLink = csl
-
-	return &l, nil
-}
+	if l.ResultLink != "" {
+		if err := validateAlias(l.ResultLink); err != nil {
+			return nil, fmt.Errorf("create link error: %w", err)
+		}
+		if _, err := ls.lstore.Create(ctx, l); err != nil {
+			return nil, fmt.Errorf("create link error: %w", err)
+		}
+		return &l, nil
+	}
 
-func createShortURL() (string, error) {
-	var result string
-	for len(result) < lenghtURL {
-		num, err := rand.Int(rand.Reader, big.NewInt(int64(127))) //nolint
+	for attempt := 0; attempt < ls.sc.Retries; attempt++ {
+		csl, err := ls.sc.generate()
 		if err != nil {
-			return "", err
+			return nil, fmt.Errorf("create link error: %w", err)
 		}
-		n := num.Int64()
-		if unicode.IsLetter(rune(n)) {
-			result += string(rune(n))
+		l.ResultLink = csl
+
+		_, err = ls.lstore.Create(ctx, l)
+		switch {
+		case err == nil:
+			return &l, nil
+		case errors.Is(err, ErrShortCodeTaken):
+			continue
+		default:
+			return nil, fmt.Errorf("create link error: %w", err)
 		}
 	}
-	return result, nil
+	return nil, fmt.Errorf("create link error: no free code after %d attempts: %w", ls.sc.Retries, ErrShortCodeTaken)
 }
 
 func (ls *Links) ReadLinkRank(ctx context.Context, uid uuid.UUID) (*linkentity.Link, error) {
@@ -91,71 +95,10 @@ func (ls *Links) Delete(ctx context.Context, uid uuid.UUID) (*linkentity.Link, e
 	return l, ls.lstore.Delete(ctx, uid)
 }
 
-func (ls *Links) SearchLinks(ctx context.Context, s string) (chan linkentity.Link, error) {
-	chin, err := ls.lstore.SearchLinks(ctx, s)
-	if err != nil {
-		return nil, err
-	}
-	chout := make(chan linkentity.Link, buf) //промежуточный буферезированый канал ссылок
-	go func() {
-		defer close(chout)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case l, ok := <-chin: //получаем очередной обьект ссылки из канала
-				if !ok {
-					return
-				}
-				chout <- l
-			}
-		}
-	}()
-	return chout, nil
-}
-
 func (ls *Links) GetLongURL(ctx context.Context, sh string) (string, error) {
-	var (
-		longURL string
-		rankURL int
-	)
-	chin, err := ls.lstore.SearchLinks(ctx, sh)
+	longURL, err := ls.lstore.GetLongURL(ctx, sh)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("get long url error: %w", err)
 	}
-	//промежуточный буферезированый канал ссылок
-	chout := make(chan linkentity.Link)
-	go func() {
-		defer close(chout)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case l, ok := <-chin: //получаем очередной обьект ссылки из канала
-				if !ok {
-					return
-				}
-				chout <- l
-				lu := <-chout
-				longURL = lu.OriginLink
-
-				ls.mu.Lock()
-				rankURL = lu.Rank + 1
-				ls.lstore.RankCounter(ctx, lu.LinkID, rankURL) //nolint
-				if err != nil {
-					log.WithFields(log.Fields{
-						"Get RankCounter:": err,
-					}).Errorf("Do Not RankCounter")
-					return
-				}
-				ls.mu.Unlock()
-			}
-		}
-	}()
-
 	return longURL, nil
 }
-
-func (ls *Links) RankCounter(ctx context.Context, uid uuid.UUID, rank int) {
-
-}
@@ -0,0 +1,129 @@
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/entities/linkentity"
+	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/infrastructure/db/memory"
+	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/usecase/app/repo"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(LinksSuite))
+
+type LinksSuite struct{}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *LinksSuite) TestCreateStoresGeneratedCode(c *gc.C) {
+	ctx := context.Background()
+	st := memory.NewLinks()
+	ls := repo.NewLinks(st, repo.ShortCodeConfig{Length: 8, Alphabet: "abc123"})
+
+	l, err := ls.Create(ctx, linkentity.Link{OriginLink: "https://example.com"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(l.ResultLink, gc.HasLen, 8)
+
+	stored, err := st.ReadLinkRank(ctx, l.LinkID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(stored.ResultLink, gc.Equals, l.ResultLink)
+}
+
+func (s *LinksSuite) TestCreateRetriesOnCollision(c *gc.C) {
+	ctx := context.Background()
+	// Всего два возможных кода: второй Create обязан найти свободный, третий - нет.
+	ls := repo.NewLinks(memory.NewLinks(), repo.ShortCodeConfig{Length: 1, Alphabet: "ab", Retries: 64})
+
+	first, err := ls.Create(ctx, linkentity.Link{OriginLink: "https://example.com/1"})
+	c.Assert(err, gc.IsNil)
+	second, err := ls.Create(ctx, linkentity.Link{OriginLink: "https://example.com/2"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(second.ResultLink, gc.Not(gc.Equals), first.ResultLink)
+
+	_, err = ls.Create(ctx, linkentity.Link{OriginLink: "https://example.com/3"})
+	c.Assert(errors.Is(err, repo.ErrShortCodeTaken), gc.Equals, true)
+}
+
+func (s *LinksSuite) TestCreateCustomAlias(c *gc.C) {
+	ctx := context.Background()
+	ls := repo.NewLinks(memory.NewLinks(), repo.DefaultShortCodeConfig())
+
+	l, err := ls.Create(ctx, linkentity.Link{OriginLink: "https://example.com", ResultLink: "my-alias"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(l.ResultLink, gc.Equals, "my-alias")
+
+	_, err = ls.Create(ctx, linkentity.Link{OriginLink: "https://example.org", ResultLink: "my-alias"})
+	c.Assert(errors.Is(err, repo.ErrShortCodeTaken), gc.Equals, true)
+
+	for _, bad := range []string{"with space", "search", "слово"} {
+		_, err = ls.Create(ctx, linkentity.Link{OriginLink: "https://example.org", ResultLink: bad})
+		c.Assert(errors.Is(err, repo.ErrInvalidAlias), gc.Equals, true, gc.Commentf("alias %q", bad))
+	}
+}
+
+func (s *LinksSuite) TestShortCodeConfigValidate(c *gc.C) {
+	c.Assert(repo.DefaultShortCodeConfig().Validate(), gc.IsNil)
+	c.Assert(repo.ShortCodeConfig{Alphabet: "a"}.Validate(), gc.NotNil)
+	c.Assert(repo.ShortCodeConfig{Alphabet: "aab"}.Validate(), gc.NotNil)
+	c.Assert(repo.ShortCodeConfig{Alphabet: "ab/"}.Validate(), gc.NotNil)
+	c.Assert(repo.ShortCodeConfig{Length: -1}.Validate(), gc.NotNil)
+}
+
+func (s *LinksSuite) TestSearchPages(c *gc.C) {
+	ctx := context.Background()
+	ls := repo.NewLinks(memory.NewLinks(), repo.DefaultShortCodeConfig())
+	for i := 0; i < 5; i++ {
+		_, err := ls.Create(ctx, linkentity.Link{OriginLink: "https://example.com/docs"})
+		c.Assert(err, gc.IsNil)
+	}
+
+	seen := make(map[string]bool)
+	req := repo.SearchRequest{Query: "docs", Order: "created", Limit: 2}
+	pages := 0
+	for {
+		sr, err := ls.SearchLinks(ctx, req)
+		c.Assert(err, gc.IsNil)
+		for l := range sr.Links {
+			c.Assert(seen[l.ResultLink], gc.Equals, false)
+			seen[l.ResultLink] = true
+		}
+		next, err := sr.Wait()
+		c.Assert(err, gc.IsNil)
+		pages++
+		if next == "" {
+			break
+		}
+		req.Cursor = next
+	}
+	c.Assert(pages, gc.Equals, 3)
+	c.Assert(seen, gc.HasLen, 5)
+}
+
+func (s *LinksSuite) TestSearchBadRequest(c *gc.C) {
+	ctx := context.Background()
+	ls := repo.NewLinks(memory.NewLinks(), repo.DefaultShortCodeConfig())
+	_, err := ls.Create(ctx, linkentity.Link{OriginLink: "https://example.com/a"})
+	c.Assert(err, gc.IsNil)
+	_, err = ls.Create(ctx, linkentity.Link{OriginLink: "https://example.com/b"})
+	c.Assert(err, gc.IsNil)
+
+	_, err = ls.SearchLinks(ctx, repo.SearchRequest{Query: "x", Order: "name"})
+	c.Assert(errors.Is(err, repo.ErrBadSearch), gc.Equals, true)
+	_, err = ls.SearchLinks(ctx, repo.SearchRequest{Query: "x", Cursor: "not a cursor"})
+	c.Assert(errors.Is(err, repo.ErrBadSearch), gc.Equals, true)
+
+	sr, err := ls.SearchLinks(ctx, repo.SearchRequest{Query: "example", Order: "rank", Limit: 1})
+	c.Assert(err, gc.IsNil)
+	for range sr.Links {
+	}
+	next, err := sr.Wait()
+	c.Assert(err, gc.IsNil)
+	c.Assert(next, gc.Not(gc.Equals), "")
+	// курсор привязан к порядку выдачи
+	_, err = ls.SearchLinks(ctx, repo.SearchRequest{Query: "example", Order: "created", Cursor: next})
+	c.Assert(err, gc.ErrorMatches, `.*cursor was issued for order "rank"`)
+}
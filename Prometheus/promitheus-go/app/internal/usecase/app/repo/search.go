@@ -0,0 +1,150 @@
+package repo
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Deny7676yar/observability/Prometheus/promitheus-go/app/internal/entities/linkentity"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultSearchLimit = 20
+	// MaxSearchLimit - больший limit урезается до него.
+	MaxSearchLimit = 100
+)
+
+var ErrBadSearch = errors.New("bad search request")
+
+// SearchRequest - запрос страницы поиска. Пустой Order означает "rank",
+// Cursor - значение NextCursor предыдущей страницы.
+type SearchRequest struct {
+	Query  string
+	Order  string
+	Cursor string
+	Limit  int
+}
+
+// Search - страница поиска, которая отдаётся потоком.
+// Links закрывается в конце страницы, после этого Wait возвращает курсор и ошибку.
+type Search struct {
+	Links chan linkentity.Link
+
+	errc chan error
+	next string
+}
+
+// Wait ждёт окончания страницы. next пустой, если страница последняя.
+func (s *Search) Wait() (next string, err error) {
+	err = <-s.errc
+	return s.next, err
+}
+
+// cursor - содержимое курсора, Order не даёт продолжить поиск с другим порядком.
+type cursor struct {
+	Order  linkentity.SearchOrder `json:"o"`
+	Rank   int                    `json:"r"`
+	LinkAt time.Time              `json:"t"`
+	LinkID uuid.UUID              `json:"id"`
+}
+
+func encodeCursor(o linkentity.SearchOrder, c linkentity.SearchCursor) string {
+	b, _ := json.Marshal(cursor{Order: o, Rank: c.Rank, LinkAt: c.LinkAt, LinkID: c.LinkID})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(o linkentity.SearchOrder, s string) (*linkentity.SearchCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrBadSearch)
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrBadSearch)
+	}
+	if c.Order != o {
+		return nil, fmt.Errorf("%w: cursor was issued for order %q", ErrBadSearch, c.Order)
+	}
+	return &linkentity.SearchCursor{Rank: c.Rank, LinkAt: c.LinkAt, LinkID: c.LinkID}, nil
+}
+
+func searchParams(req SearchRequest) (linkentity.SearchParams, error) {
+	p := linkentity.SearchParams{
+		Query: req.Query,
+		Order: linkentity.SearchOrder(req.Order),
+		Limit: req.Limit,
+	}
+	switch p.Order {
+	case "":
+		p.Order = linkentity.OrderRank
+	case linkentity.OrderRank, linkentity.OrderCreated:
+	default:
+		return p, fmt.Errorf("%w: order must be %q or %q", ErrBadSearch, linkentity.OrderRank, linkentity.OrderCreated)
+	}
+	switch {
+	case p.Limit < 0:
+		return p, fmt.Errorf("%w: negative limit", ErrBadSearch)
+	case p.Limit == 0:
+		p.Limit = DefaultSearchLimit
+	case p.Limit > MaxSearchLimit:
+		p.Limit = MaxSearchLimit
+	}
+	if req.Cursor != "" {
+		after, err := decodeCursor(p.Order, req.Cursor)
+		if err != nil {
+			return p, err
+		}
+		p.After = after
+	}
+	return p, nil
+}
+
+// SearchLinks ищет ссылки по подстроке в исходной ссылке или коротком коде.
+// Ошибки в параметрах запроса возвращаются сразу и оборачивают ErrBadSearch.
+func (ls *Links) SearchLinks(ctx context.Context, req SearchRequest) (*Search, error) {
+	p, err := searchParams(req)
+	if err != nil {
+		return nil, err
+	}
+	limit := p.Limit
+	// лишняя ссылка показывает, что есть следующая страница
+	p.Limit++
+	chin, errin := ls.lstore.SearchLinks(ctx, p)
+
+	s := &Search{
+		Links: make(chan linkentity.Link, buf), //промежуточный буферезированый канал ссылок
+		errc:  make(chan error, 1),
+	}
+	go func() {
+		defer close(s.errc)
+		n := 0
+		var last linkentity.Link
+		for l := range chin {
+			n++
+			if n > limit {
+				s.next = encodeCursor(p.Order, linkentity.CursorOf(last))
+				continue // дочитываем канал, чтобы хранилище завершилось
+			}
+			select {
+			case <-ctx.Done():
+			case s.Links <- l:
+				last = l
+			}
+		}
+		close(s.Links)
+		err := <-errin
+		if err == nil {
+			// при отмене часть ссылок могла быть пропущена, курсор недействителен
+			err = ctx.Err()
+		}
+		if err != nil {
+			s.next = ""
+			s.errc <- fmt.Errorf("search links error: %w", err)
+		}
+	}()
+	return s, nil
+}
@@ -0,0 +1,120 @@
+package repo
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	DefaultShortCodeLength   = 5
+	DefaultShortCodeAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	DefaultShortCodeRetries  = 5
+
+	maxAliasLength = 64
+	aliasChars     = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"
+)
+
+var (
+	// ErrShortCodeTaken - хранилище уже содержит ссылку с таким коротким кодом.
+	ErrShortCodeTaken = errors.New("short code already taken")
+	// ErrInvalidAlias - пользовательский код не подходит для адреса перехода.
+	ErrInvalidAlias = errors.New("invalid custom alias")
+)
+
+// reservedAliases - первые сегменты путей API, под которыми алиас был бы недостижим.
+var reservedAliases = map[string]bool{
+	"create": true,
+	"read":   true,
+	"delete": true,
+	"search": true,
+}
+
+// ShortCodeConfig - параметры генерации коротких кодов.
+type ShortCodeConfig struct {
+	// Length - длина сгенерированного кода.
+	Length int
+	// Alphabet - символы, из которых собирается код.
+	Alphabet string
+	// Retries - сколько раз пробовать новый код при коллизии.
+	Retries int
+}
+
+func DefaultShortCodeConfig() ShortCodeConfig {
+	return ShortCodeConfig{
+		Length:   DefaultShortCodeLength,
+		Alphabet: DefaultShortCodeAlphabet,
+		Retries:  DefaultShortCodeRetries,
+	}
+}
+
+// withDefaults подставляет значения по умолчанию вместо незаданных полей.
+func (c ShortCodeConfig) withDefaults() ShortCodeConfig {
+	if c.Length == 0 {
+		c.Length = DefaultShortCodeLength
+	}
+	if c.Alphabet == "" {
+		c.Alphabet = DefaultShortCodeAlphabet
+	}
+	if c.Retries == 0 {
+		c.Retries = DefaultShortCodeRetries
+	}
+	return c
+}
+
+func (c ShortCodeConfig) Validate() error {
+	c = c.withDefaults()
+	if c.Length < 1 || c.Length > maxAliasLength {
+		return fmt.Errorf("short code length must be in [1, %d], got %d", maxAliasLength, c.Length)
+	}
+	if c.Retries < 1 {
+		return fmt.Errorf("short code retries must be positive, got %d", c.Retries)
+	}
+	seen := make(map[rune]bool)
+	for _, r := range c.Alphabet {
+		if !strings.ContainsRune(aliasChars, r) {
+			return fmt.Errorf("short code alphabet contains non url-safe symbol %q", r)
+		}
+		if seen[r] {
+			return fmt.Errorf("short code alphabet contains duplicate symbol %q", r)
+		}
+		seen[r] = true
+	}
+	if len(seen) < 2 {
+		return fmt.Errorf("short code alphabet must contain at least 2 symbols")
+	}
+	return nil
+}
+
+// generate - случайный код из алфавита, символы выбираются равновероятно.
+func (c ShortCodeConfig) generate() (string, error) {
+	alphabet := []rune(c.Alphabet)
+	max := big.NewInt(int64(len(alphabet)))
+	var sb strings.Builder
+	for i := 0; i < c.Length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteRune(alphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// validateAlias проверяет пользовательский код: непустой, url-safe и не совпадает с путями API.
+func validateAlias(alias string) error {
+	if len(alias) > maxAliasLength {
+		return fmt.Errorf("%w: longer than %d symbols", ErrInvalidAlias, maxAliasLength)
+	}
+	for _, r := range alias {
+		if !strings.ContainsRune(aliasChars, r) {
+			return fmt.Errorf("%w: symbol %q is not allowed", ErrInvalidAlias, r)
+		}
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidAlias, alias)
+	}
+	return nil
+}
@@ -2,16 +2,36 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/pprof"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/Deny7676yar/observability/pkg/dbmetrics"
+	"github.com/Deny7676yar/observability/pkg/health"
+	"github.com/Deny7676yar/observability/pkg/lifecycle"
+	"github.com/Deny7676yar/observability/pkg/logctx"
+	"github.com/Deny7676yar/observability/pkg/loglevel"
+	"github.com/Deny7676yar/observability/pkg/pgxtrace"
+	"github.com/Deny7676yar/observability/pkg/recovery"
+	"github.com/Deny7676yar/observability/pkg/requestid"
+	"github.com/Deny7676yar/observability/pkg/sentryreport"
+	"github.com/Deny7676yar/observability/pkg/tracing"
+	"github.com/getsentry/sentry-go"
 	"github.com/go-chi/chi"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/log/zapadapter"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -21,10 +41,26 @@ type Repository interface {
 	GetUsers(ctx context.Context) ([]User, error)
 	GetUsersByName(ctx context.Context, name string) ([]*User, error)
 	GetUserArticles(ctx context.Context, userID uuid.UUID) ([]Article, error)
+
+	// Изменения возвращают прежнее состояние (UpdateUser, Delete*) или
+	// сохранённое (Create*, UpdateArticle): по нему кеш определяет, какие ключи сбросить.
+	// Если изменяемой записи нет - ErrNotFound.
+	CreateUser(ctx context.Context, name string) (*User, error)
+	UpdateUser(ctx context.Context, id uuid.UUID, name string) (old *User, err error)
+	DeleteUser(ctx context.Context, id uuid.UUID) (old *User, err error)
+	CreateArticle(ctx context.Context, a Article) (*Article, error)
+	UpdateArticle(ctx context.Context, a Article) (*Article, error)
+	DeleteArticle(ctx context.Context, id uuid.UUID) (old *Article, err error)
 }
 
 type app struct {
+	cfg        Config
+	health     *health.Checker
 	logger     *zap.Logger
+	levels     *loglevel.Levels
+	sentry     *sentry.Hub
+	recovery   *recovery.Recovery
+	tp         trace.TracerProvider
 	pool       *pgxpool.Pool
 	repository Repository
 }
@@ -36,18 +72,18 @@ func (a *app) parseUserID(r *http.Request) (*uuid.UUID, error) {
 	}
 	userID, err := uuid.Parse(strUserID)
 	if err != nil {
-		a.logger.Debug(
+		logctx.Zap(r.Context(), a.logger).Debug(
 			fmt.Sprintf("failed to parse userID (uuid) from: '%s'", strUserID),
 			zap.Field{Key: "error", String: err.Error(), Type: zapcore.StringType},
 		)
 		return nil, err
 	}
-	a.logger.Debug(fmt.Sprintf("userID parsed: %s", userID))
+	logctx.Zap(r.Context(), a.logger).Debug(fmt.Sprintf("userID parsed: %s", userID))
 	return &userID, nil
 }
 
 func (a *app) userHandler(w http.ResponseWriter, r *http.Request) {
-	a.logger.Info("userHandler called", zap.Field{Key: "method", String: r.Method,
+	logctx.Zap(r.Context(), a.logger).Info("userHandler called", zap.Field{Key: "method", String: r.Method,
 		Type: zapcore.StringType})
 	ctx := r.Context()
 	userID, err := a.parseUserID(r)
@@ -61,6 +97,8 @@ func (a *app) userHandler(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case errors.Is(err, ErrNotFound):
 			status = http.StatusNotFound
+		default:
+			logctx.Zap(ctx, a.logger).Error("failed to get user", zap.Error(err))
 		}
 		writeResponse(w, status, fmt.Sprintf(`failed to get user with id %s: %s`,
 			userID, err))
@@ -70,7 +108,7 @@ func (a *app) userHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *app) usersByNameHandler(w http.ResponseWriter, r *http.Request) {
-	a.logger.Info("userHandler called", zap.Field{Key: "method", String: r.Method,
+	logctx.Zap(r.Context(), a.logger).Info("userHandler called", zap.Field{Key: "method", String: r.Method,
 		Type: zapcore.StringType})
 	ctx := r.Context()
 	userName := chi.URLParam(r, "name")
@@ -84,6 +122,8 @@ func (a *app) usersByNameHandler(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case errors.Is(err, ErrNotFound):
 			status = http.StatusNotFound
+		default:
+			logctx.Zap(ctx, a.logger).Error("failed to get users by name", zap.Error(err))
 		}
 		writeResponse(w, status, fmt.Sprintf(`failed to get users with name %s: %s`, userName, err.Error()))
 		return
@@ -92,7 +132,7 @@ func (a *app) usersByNameHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *app) userArticlesHandler(w http.ResponseWriter, r *http.Request) {
-	a.logger.Info("userArticlesHandler called", zap.Field{Key: "method", String: r.Method, Type: zapcore.StringType})
+	logctx.Zap(r.Context(), a.logger).Info("userArticlesHandler called", zap.Field{Key: "method", String: r.Method, Type: zapcore.StringType})
 	userID, err := a.parseUserID(r)
 	if err != nil {
 		writeResponse(w, http.StatusBadRequest, fmt.Sprintf(`failed to parse user's id: %s`, err))
@@ -100,49 +140,266 @@ func (a *app) userArticlesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	articles, err := a.repository.GetUserArticles(r.Context(), *userID)
 	if err != nil {
+		logctx.Zap(r.Context(), a.logger).Error("failed to get user's articles", zap.Error(err))
 		writeResponse(w, http.StatusInternalServerError, fmt.Sprintf(`failed to get user's (id: %s) articles: %s`, userID, err))
 		return
 	}
 	writeJsonResponse(w, http.StatusOK, articles)
 }
 
+// userRequest - тело POST /users и PUT /users/{id}.
+type userRequest struct {
+	Name string `json:"name"`
+}
+
+// articleRequest - тело POST /users/{id}/articles и PUT /articles/{id}.
+type articleRequest struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+// maxNameLen - длина users.name и articles.title в базе, в символах.
+const maxNameLen = 150
+
+// decodeRequest читает JSON-тело запроса в dst и проверяет длину обязательного поля field.
+func decodeRequest(r *http.Request, dst interface{}, field string, value func() string) error {
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		return fmt.Errorf("bad request body: %w", err)
+	}
+	if v := value(); v == "" || utf8.RuneCountInString(v) > maxNameLen {
+		return fmt.Errorf("%s must be 1 to %d characters long", field, maxNameLen)
+	}
+	return nil
+}
+
+// writeRepositoryError отвечает 404 на ErrNotFound и 500 с записью в лог на остальные ошибки.
+func (a *app) writeRepositoryError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	if errors.Is(err, ErrNotFound) {
+		writeResponse(w, http.StatusNotFound, fmt.Sprintf("%s: %s", msg, err))
+		return
+	}
+	logctx.Zap(r.Context(), a.logger).Error(msg, zap.Error(err))
+	writeResponse(w, http.StatusInternalServerError, fmt.Sprintf("%s: %s", msg, err))
+}
+
+func (a *app) createUserHandler(w http.ResponseWriter, r *http.Request) {
+	var req userRequest
+	if err := decodeRequest(r, &req, "name", func() string { return req.Name }); err != nil {
+		writeResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	user, err := a.repository.CreateUser(r.Context(), req.Name)
+	if err != nil {
+		a.writeRepositoryError(w, r, "failed to create user", err)
+		return
+	}
+	writeJsonResponse(w, http.StatusCreated, user)
+}
+
+func (a *app) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := a.parseUserID(r)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, fmt.Sprintf(`failed to parse user's id: %s`, err))
+		return
+	}
+	var req userRequest
+	if err := decodeRequest(r, &req, "name", func() string { return req.Name }); err != nil {
+		writeResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := a.repository.UpdateUser(r.Context(), *userID, req.Name); err != nil {
+		a.writeRepositoryError(w, r, fmt.Sprintf("failed to update user with id %s", userID), err)
+		return
+	}
+	writeJsonResponse(w, http.StatusOK, &User{ID: *userID, Name: req.Name})
+}
+
+func (a *app) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := a.parseUserID(r)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, fmt.Sprintf(`failed to parse user's id: %s`, err))
+		return
+	}
+	if _, err := a.repository.DeleteUser(r.Context(), *userID); err != nil {
+		a.writeRepositoryError(w, r, fmt.Sprintf("failed to delete user with id %s", userID), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *app) createArticleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := a.parseUserID(r)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, fmt.Sprintf(`failed to parse user's id: %s`, err))
+		return
+	}
+	var req articleRequest
+	if err := decodeRequest(r, &req, "title", func() string { return req.Title }); err != nil {
+		writeResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	article, err := a.repository.CreateArticle(r.Context(), Article{UserID: *userID, Title: req.Title, Text: req.Text})
+	if err != nil {
+		a.writeRepositoryError(w, r, fmt.Sprintf("failed to create article for user %s", userID), err)
+		return
+	}
+	writeJsonResponse(w, http.StatusCreated, article)
+}
+
+// parseArticleID - идентификатор статьи из маршрута /articles/{id}.
+func parseArticleID(r *http.Request) (uuid.UUID, error) {
+	return uuid.Parse(chi.URLParam(r, "id"))
+}
+
+func (a *app) updateArticleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseArticleID(r)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, fmt.Sprintf(`failed to parse article's id: %s`, err))
+		return
+	}
+	var req articleRequest
+	if err := decodeRequest(r, &req, "title", func() string { return req.Title }); err != nil {
+		writeResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	article, err := a.repository.UpdateArticle(r.Context(), Article{ID: id, Title: req.Title, Text: req.Text})
+	if err != nil {
+		a.writeRepositoryError(w, r, fmt.Sprintf("failed to update article with id %s", id), err)
+		return
+	}
+	writeJsonResponse(w, http.StatusOK, article)
+}
+
+func (a *app) deleteArticleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseArticleID(r)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, fmt.Sprintf(`failed to parse article's id: %s`, err))
+		return
+	}
+	if _, err := a.repository.DeleteArticle(r.Context(), id); err != nil {
+		a.writeRepositoryError(w, r, fmt.Sprintf("failed to delete article with id %s", id), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// panicHandler - проверка recovery: паника превращается в ответ 500 и запись в логе.
 func (a *app) panicHandler(w http.ResponseWriter, r *http.Request) {
-	defer func() {
-		_ = recover()
-		writeResponse(w, http.StatusOK, "panic logged, see server log")
-	}()
-	a.logger.Panic("panic!!!")
+	panic("panic!!!")
 }
 
-func (a *app) Init(ctx context.Context, logger *zap.Logger) error {
-	config, err := pgxpool.ParseConfig(DatabaseURL)
+func (a *app) Init(ctx context.Context, cfg Config, logger *zap.Logger, tp trace.TracerProvider, hub *sentry.Hub, levels *loglevel.Levels) error {
+	config, err := pgxpool.ParseConfig(cfg.DatabaseURL)
 	if err != nil {
-		return fmt.Errorf("failed to parse conn string (%s): %w", DatabaseURL, err)
+		return fmt.Errorf("failed to parse conn string: %w", err)
 	}
 	config.ConnConfig.LogLevel = pgx.LogLevelDebug
-	config.ConnConfig.Logger = zapadapter.NewLogger(logger) // логгер запросов в БД
+	// логгер запросов в БД, он же создаёт спаны запросов
+	config.ConnConfig.Logger = pgxtrace.NewLogger(tp, zapadapter.NewLogger(levels.Named(logger, "pgx")))
 	pool, err := pgxpool.ConnectConfig(ctx, config)
 	if err != nil {
 		return fmt.Errorf("unable to connect to database: %w", err)
 	}
-	a.logger = logger
+	a.cfg = cfg
+	a.levels = levels
+	a.logger = levels.Named(logger, "http")
+	a.sentry = hub
+	if a.recovery, err = recovery.New(prometheus.DefaultRegisterer, Namespace); err != nil {
+		return err
+	}
+	a.tp = tp
 	a.pool = pool
-	a.repository = NewCachedRepository(NewRepository(a.pool), a.logger)
-	//a.repository = NewRepository(a.pool)
+	metrics := dbmetrics.NewCollector(Namespace, "app", dbmetrics.PgxPoolStats(pool), ErrNotFound)
+	if err := prometheus.Register(metrics); err != nil {
+		return fmt.Errorf("failed to register db metrics: %w", err)
+	}
+	cache, err := NewCache(ctx, cfg.Cache, cfg.Redis, tp, prometheus.DefaultRegisterer)
+	if err != nil {
+		return err
+	}
+	a.repository, err = NewCachedRepository(NewRepository(a.pool, metrics), cache, tp, prometheus.DefaultRegisterer,
+		levels.Named(logger, "cache"))
+	if err != nil {
+		return err
+	}
+	a.health = health.New(cfg.DrainDelay)
+	a.health.Add("postgres", 0, a.pool.Ping)
+	// без кеша сервис работает медленнее, но работает: проверка только отмечает деградацию
+	a.health.AddOptional("cache", 0, cache.Ping)
+	//a.repository = NewRepository(a.pool, metrics)
 	return nil
 }
 
-func (a *app) Serve() error {
+// Handler - маршруты сервиса. Входящий контекст трейса извлекается из заголовков W3C,
+// серверный спан называется по шаблону маршрута, X-Request-ID принимается или создаётся,
+// паники обработчиков превращаются в ответ 500. Пробы и /debug не трейсятся.
+func (a *app) Handler() http.Handler {
 	r := chi.NewRouter()
+	r.Use(routeSpanName, requestid.Middleware, a.recovery.Middleware(a.logger, routePattern), sentryreport.Middleware(a.sentry))
+	r.Handle("/healthz", a.health.LiveHandler())
+	r.Handle("/readyz", a.health.ReadyHandler())
 	r.Get("/users/{id}", http.HandlerFunc(a.userHandler))
 	r.Get("/users/name/{name}", http.HandlerFunc(a.usersByNameHandler))
 	r.Get("/users/{id}/articles", http.HandlerFunc(a.userArticlesHandler))
+	r.Post("/users", http.HandlerFunc(a.createUserHandler))
+	r.Put("/users/{id}", http.HandlerFunc(a.updateUserHandler))
+	r.Delete("/users/{id}", http.HandlerFunc(a.deleteUserHandler))
+	r.Post("/users/{id}/articles", http.HandlerFunc(a.createArticleHandler))
+	r.Put("/articles/{id}", http.HandlerFunc(a.updateArticleHandler))
+	r.Delete("/articles/{id}", http.HandlerFunc(a.deleteArticleHandler))
 	r.Get("/panic", http.HandlerFunc(a.panicHandler))
-	r.Mount("/debug", Profiler())
-	return http.ListenAndServe(":9000", r)
+	r.Mount("/debug", Profiler(a.levels))
+	return otelhttp.NewHandler(r, "http.server",
+		otelhttp.WithTracerProvider(a.tp),
+		otelhttp.WithPropagators(tracing.Propagator()),
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			switch {
+			case r.URL.Path == "/healthz", r.URL.Path == "/readyz", strings.HasPrefix(r.URL.Path, "/debug/"):
+				return false
+			}
+			return true
+		}),
+	)
+}
+
+// routeSpanName переименовывает серверный спан в "GET /users/{id}" после того, как chi выбрал маршрут.
+func routeSpanName(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		route := routePattern(r)
+		if route == "" {
+			return
+		}
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(semconv.HTTPRouteKey.String(route))
+	})
+}
+
+// routePattern - шаблон маршрута, выбранного chi, или "", если запрос ни в один не попал.
+func routePattern(r *http.Request) string {
+	if rc := chi.RouteContext(r.Context()); rc != nil {
+		return rc.RoutePattern()
+	}
+	return ""
+}
+
+// spanError отмечает спан как завершившийся ошибкой.
+func spanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Serve обслуживает запросы до отмены ctx, затем останавливает сервер через lifecycle.Manager.
+func (a *app) Serve(ctx context.Context) error {
+	lc := lifecycle.New(lifecycle.DefaultShutdownTimeout)
+	lc.OnShutdown(a.health.Drain)
+	lc.Add("http", &http.Server{Addr: a.cfg.HTTPAddr, Handler: a.Handler()})
+	return lc.Run(ctx)
 }
 
-func Profiler() http.Handler {
+// Profiler - отладочные ручки: pprof, метрики и уровни логов levels.
+func Profiler(levels *loglevel.Levels) http.Handler {
 	r := chi.NewRouter()
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, r.RequestURI+"/pprof/", http.StatusMovedPermanently)
@@ -159,6 +416,10 @@ func Profiler() http.Handler {
 	r.HandleFunc("/pprof/symbol", pprof.Symbol)
 	// профиль для получения трассировки (последовательности инструкций) выполнения приложения за время seconds из query-параметров ( по-умолчанию 1с)
 	r.HandleFunc("/pprof/trace", pprof.Trace)
+	// метрики Prometheus: пул соединений и запросы к БД
+	r.Handle("/metrics", promhttp.Handler())
+	// уровни логов: GET - текущие, PUT {"level", "component", "ttl"} - изменить
+	r.Handle("/loglevel", levels.Handler())
 
 	return r
 }
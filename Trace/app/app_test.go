@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(DecodeSuite))
+
+type DecodeSuite struct{}
+
+func decodeName(name string) error {
+	body := `{"name":"` + name + `"}`
+	r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+	var req userRequest
+	return decodeRequest(r, &req, "name", func() string { return req.Name })
+}
+
+func (s *DecodeSuite) TestNameLengthInCharacters(c *gc.C) {
+	c.Assert(decodeName(strings.Repeat("ж", maxNameLen)), gc.IsNil)
+	c.Assert(decodeName(strings.Repeat("ж", maxNameLen+1)), gc.ErrorMatches, "name must be 1 to 150 characters long")
+	c.Assert(decodeName(""), gc.ErrorMatches, "name must be 1 to 150 characters long")
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrCacheMiss - значения нет в кеше.
+var ErrCacheMiss = errors.New("cache miss")
+
+// Cache - хранилище значений cachedRepository. Время жизни значения определяет
+// Expiry хранилища по префиксу ключа.
+type Cache interface {
+	// Get читает значение key в dst. Если значения нет - ErrCacheMiss.
+	Get(ctx context.Context, key string, dst interface{}) (Lookup, error)
+	// Set кладёт value в кеш. Значения сущностей без TTL не сохраняются.
+	Set(ctx context.Context, key string, value interface{}) error
+	Delete(ctx context.Context, key string) error
+	// Ping проверяет доступность хранилища, используется в /readyz.
+	Ping(ctx context.Context) error
+}
+
+// Lookup - найденное значение.
+type Lookup struct {
+	// Source - слой, где нашлось значение: SourceLocal или SourceRedis.
+	Source string
+	// Stale - TTL значения истёк, оно хранится ещё Expiry.Stale и должно быть обновлено.
+	Stale bool
+}
+
+// Entity - вид кешируемых значений, он же префикс ключа.
+type Entity string
+
+const (
+	EntityUser         Entity = "user"
+	EntityUsersByName  Entity = "users-name"
+	EntityUserArticles Entity = "user_articles"
+)
+
+// Key - ключ значения сущности с идентификатором id.
+func (e Entity) Key(id string) string {
+	return string(e) + ":" + id
+}
+
+// entityOf - сущность ключа key.
+func entityOf(key string) Entity {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return Entity(key[:i])
+	}
+	return Entity(key)
+}
+
+// TTLPolicy - время жизни значений по сущностям. Сущности без TTL в хранилище не попадают.
+type TTLPolicy map[Entity]time.Duration
+
+// TTL - время жизни значения key.
+func (p TTLPolicy) TTL(key string) time.Duration {
+	return p[entityOf(key)]
+}
+
+// Expiry - время жизни значений в хранилище.
+type Expiry struct {
+	TTL TTLPolicy
+	// Stale - сколько значение хранится после TTL: его отдают устаревшим, пока оно
+	// обновляется в фоне (stale-while-revalidate). 0 - не хранится.
+	Stale time.Duration
+	// Jitter - доля TTL, на которую он случайно уменьшается, чтобы значения,
+	// записанные одновременно, не истекали одновременно.
+	Jitter float64
+}
+
+// ttl - сколько значение key свежее (с учётом Jitter) и сколько его хранить.
+// Значения сущностей без TTL не хранятся: keep = 0.
+func (e Expiry) ttl(key string) (fresh, keep time.Duration) {
+	fresh = e.TTL.TTL(key)
+	if fresh <= 0 {
+		return 0, 0
+	}
+	if e.Jitter > 0 {
+		fresh -= time.Duration(rand.Float64() * e.Jitter * float64(fresh))
+	}
+	return fresh, fresh + e.Stale
+}
+
+// Хранилища кеша, CacheConfig.Backend.
+const (
+	CacheTiered = "tiered" // память процесса, затем Redis
+	CacheRedis  = "redis"
+	CacheLocal  = "local"
+	CacheNoop   = "noop"
+)
+
+// NewCache создаёт хранилище cfg.Backend. Команды Redis трейсятся через tp, метрики
+// слоёв регистрируются в reg. Redis работает через breakerCache, если cfg.Breaker.Failures > 0.
+// Для CacheTiered до отмены ctx работает подписка на
+// InvalidationChannel: ключи, удалённые любым экземпляром сервиса, сбрасываются в памяти.
+func NewCache(ctx context.Context, cfg CacheConfig, rcfg RedisConfig, tp trace.TracerProvider,
+	reg prometheus.Registerer) (Cache, error) {
+	if cfg.Stale < 0 {
+		return nil, errors.New("cache stale must not be negative")
+	}
+	if cfg.TTLJitter < 0 || cfg.TTLJitter >= 1 {
+		return nil, errors.New("cache ttl jitter must be in [0, 1)")
+	}
+	if cfg.Breaker.Failures > 0 && cfg.Breaker.OpenTimeout <= 0 {
+		return nil, errors.New("cache breaker open timeout must be positive")
+	}
+	switch cfg.Backend {
+	case CacheTiered, CacheRedis, CacheLocal:
+	case CacheNoop:
+		return noopCache{}, nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+	}
+	m, err := newLayerMetrics(reg, Namespace)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		local, remote Cache
+		rc            *redisCache
+	)
+	if cfg.Backend != CacheRedis {
+		lc := newLocalCache(cfg.Local.Size, Expiry{TTL: cfg.Local.TTL(), Stale: cfg.Stale, Jitter: cfg.TTLJitter})
+		if err := registerLocalSize(reg, Namespace, lc); err != nil {
+			return nil, err
+		}
+		local = instrument(lc, SourceLocal, m)
+	}
+	if cfg.Backend != CacheLocal {
+		rc = newRedisCache(newRedisClient(rcfg, tp), Expiry{TTL: rcfg.TTL(), Stale: cfg.Stale, Jitter: cfg.TTLJitter})
+		remote = instrument(rc, SourceRedis, m)
+		if cfg.Breaker.Failures > 0 {
+			bm, err := newBreakerMetrics(reg, Namespace)
+			if err != nil {
+				return nil, err
+			}
+			remote = newBreakerCache(remote, SourceRedis, cfg.Breaker, bm)
+		}
+	}
+	switch {
+	case local == nil:
+		return remote, nil
+	case remote == nil:
+		return local, nil
+	}
+	rc.subscribe(ctx, func(ctx context.Context, key string) {
+		_ = local.Delete(ctx, key)
+	})
+	return newTieredCache(local, remote), nil
+}
+
+// noopCache ничего не хранит: все чтения идут в базу.
+type noopCache struct{}
+
+func (noopCache) Get(context.Context, string, interface{}) (Lookup, error) {
+	return Lookup{}, ErrCacheMiss
+}
+
+func (noopCache) Set(context.Context, string, interface{}) error { return nil }
+
+func (noopCache) Delete(context.Context, string) error { return nil }
+
+func (noopCache) Ping(context.Context) error { return nil }
+
+// tieredCache читает из local, при промахе или устаревшем значении - из remote
+// и сохраняет найденное свежее значение в local.
+type tieredCache struct {
+	local  Cache
+	remote Cache
+}
+
+func newTieredCache(local, remote Cache) *tieredCache {
+	return &tieredCache{local: local, remote: remote}
+}
+
+func (c *tieredCache) Get(ctx context.Context, key string, dst interface{}) (Lookup, error) {
+	lk, err := c.local.Get(ctx, key, dst)
+	switch {
+	case err == nil && !lk.Stale:
+		return lk, nil
+	case err != nil && err != ErrCacheMiss:
+		return Lookup{}, err
+	}
+	rk, rerr := c.remote.Get(ctx, key, dst)
+	switch {
+	case rerr == nil && !rk.Stale:
+		// значение уже прочитано: неудачная запись в память не ошибка чтения,
+		// её учитывает write_errors_total слоя local
+		_ = c.local.Set(ctx, key, dst)
+		return rk, nil
+	case rerr == nil:
+		return rk, nil
+	case err == nil:
+		// в памяти есть устаревшее значение, его и отдаём
+		return lk, nil
+	}
+	return Lookup{}, rerr
+}
+
+func (c *tieredCache) Set(ctx context.Context, key string, value interface{}) error {
+	if err := c.local.Set(ctx, key, value); err != nil {
+		return err
+	}
+	return c.remote.Set(ctx, key, value)
+}
+
+func (c *tieredCache) Delete(ctx context.Context, key string) error {
+	if err := c.local.Delete(ctx, key); err != nil {
+		return err
+	}
+	return c.remote.Delete(ctx, key)
+}
+
+func (c *tieredCache) Ping(ctx context.Context) error {
+	return c.remote.Ping(ctx)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCacheUnavailable - breaker открыт: хранилище не вызывается до конца BreakerConfig.OpenTimeout.
+var ErrCacheUnavailable = errors.New("cache unavailable")
+
+// BreakerState - состояние breakerCache, оно же значение метрики cache_breaker_state.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // операции идут в хранилище
+	BreakerHalfOpen                     // идёт одна пробная операция, остальные отклоняются
+	BreakerOpen                         // операции отклоняются с ErrCacheUnavailable
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half_open"
+	case BreakerOpen:
+		return "open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// breakerCache - circuit breaker вокруг слоя кеша. После Failures ошибок подряд breaker
+// открывается, и операции сразу возвращают ErrCacheUnavailable, не дожидаясь таймаутов
+// недоступного Redis. Через OpenTimeout одна операция пропускается пробной: успех
+// закрывает breaker, ошибка открывает его снова. ErrCacheMiss и отмена запроса клиентом
+// ошибками не считаются.
+type breakerCache struct {
+	Cache
+	layer       string
+	failures    int
+	openTimeout time.Duration
+	metrics     *breakerMetrics
+
+	mu       sync.Mutex
+	state    BreakerState
+	failed   int // ошибок подряд в состоянии BreakerClosed
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreakerCache(c Cache, layer string, cfg BreakerConfig, m *breakerMetrics) *breakerCache {
+	m.state.WithLabelValues(layer).Set(float64(BreakerClosed))
+	return &breakerCache{
+		Cache:       c,
+		layer:       layer,
+		failures:    cfg.Failures,
+		openTimeout: cfg.OpenTimeout,
+		metrics:     m,
+	}
+}
+
+// State - текущее состояние breaker.
+func (b *breakerCache) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *breakerCache) Get(ctx context.Context, key string, dst interface{}) (Lookup, error) {
+	var lk Lookup
+	err := b.do(func() (err error) {
+		lk, err = b.Cache.Get(ctx, key, dst)
+		return err
+	})
+	return lk, err
+}
+
+func (b *breakerCache) Set(ctx context.Context, key string, value interface{}) error {
+	return b.do(func() error {
+		return b.Cache.Set(ctx, key, value)
+	})
+}
+
+func (b *breakerCache) Delete(ctx context.Context, key string) error {
+	return b.do(func() error {
+		return b.Cache.Delete(ctx, key)
+	})
+}
+
+// Ping проходит через breaker: проверки /readyz тоже открывают и закрывают его.
+// Ошибка содержит состояние breaker после проверки.
+func (b *breakerCache) Ping(ctx context.Context) error {
+	if err := b.do(func() error { return b.Cache.Ping(ctx) }); err != nil {
+		return fmt.Errorf("circuit breaker %s: %w", b.State(), err)
+	}
+	return nil
+}
+
+// do выполняет fn, если breaker её пропускает, и учитывает результат.
+func (b *breakerCache) do(fn func() error) error {
+	probe, err := b.allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	b.done(probe, err)
+	return err
+}
+
+// allow решает, пропустить ли операцию; probe - операция пробная.
+func (b *breakerCache) allow() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		return false, nil
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false, ErrCacheUnavailable
+		}
+		b.setState(BreakerHalfOpen)
+	}
+	if b.probing {
+		return false, ErrCacheUnavailable
+	}
+	b.probing = true
+	return true, nil
+}
+
+// done учитывает результат операции. Результаты операций, начатых до открытия
+// breaker, на его состояние не влияют.
+func (b *breakerCache) done(probe bool, err error) {
+	failed := err != nil && err != ErrCacheMiss && !errors.Is(err, context.Canceled)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	switch {
+	case probe && failed:
+		b.open()
+	case probe:
+		b.failed = 0
+		b.setState(BreakerClosed)
+	case b.state != BreakerClosed:
+	case failed:
+		b.failed++
+		if b.failed >= b.failures {
+			b.open()
+		}
+	default:
+		b.failed = 0
+	}
+}
+
+func (b *breakerCache) open() {
+	b.failed = 0
+	b.openedAt = time.Now()
+	b.setState(BreakerOpen)
+}
+
+func (b *breakerCache) setState(s BreakerState) {
+	if b.state == s {
+		return
+	}
+	b.state = s
+	b.metrics.state.WithLabelValues(b.layer).Set(float64(s))
+	b.metrics.transitions.WithLabelValues(b.layer, s.String()).Inc()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/vmihailenco/go-tinylfu"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// localSamples - сколько обращений TinyLFU учитывает, прежде чем "состарить" частоты.
+const localSamples = 100000
+
+// localCache - кеш в памяти процесса с вытеснением TinyLFU. Значения хранятся
+// сериализованными: вызывающий не может изменить закешированное значение.
+type localCache struct {
+	mu     sync.Mutex
+	lfu    *tinylfu.T
+	expiry Expiry
+}
+
+// localEntry - значение и момент, после которого оно устаревшее.
+type localEntry struct {
+	value      []byte
+	freshUntil time.Time
+}
+
+func newLocalCache(size int, expiry Expiry) *localCache {
+	return &localCache{
+		lfu:    tinylfu.New(size, localSamples),
+		expiry: expiry,
+	}
+}
+
+func (c *localCache) Get(ctx context.Context, key string, dst interface{}) (Lookup, error) {
+	c.mu.Lock()
+	v, ok := c.lfu.Get(key)
+	c.mu.Unlock()
+	if !ok {
+		return Lookup{}, ErrCacheMiss
+	}
+	e := v.(localEntry)
+	if err := msgpack.Unmarshal(e.value, dst); err != nil {
+		return Lookup{}, err
+	}
+	return Lookup{Source: SourceLocal, Stale: time.Now().After(e.freshUntil)}, nil
+}
+
+func (c *localCache) Set(ctx context.Context, key string, value interface{}) error {
+	fresh, keep := c.expiry.ttl(key)
+	if keep <= 0 {
+		return nil
+	}
+	b, err := msgpack.Marshal(value)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// tinylfu не заменяет значение существующего ключа, а добавляет второй элемент
+	c.lfu.Del(key)
+	now := time.Now()
+	c.lfu.Set(&tinylfu.Item{
+		Key:      key,
+		Value:    localEntry{value: b, freshUntil: now.Add(fresh)},
+		ExpireAt: now.Add(keep),
+	})
+	return nil
+}
+
+func (c *localCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	c.lfu.Del(key)
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *localCache) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Len - сколько значений в памяти, включая истёкшие, но ещё не вытесненные.
+// У tinylfu.T нет Len: считается размер его карты data.
+func (c *localCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return reflect.ValueOf(c.lfu).Elem().FieldByName("data").Len()
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Метки метрик кеша.
+const (
+	LabelLayer     = "layer"
+	LabelEntity    = "entity"
+	LabelOperation = "operation"
+	LabelResult    = "result"
+	LabelTrigger   = "trigger"
+	LabelReason    = "reason"
+	LabelState     = "state"
+)
+
+// Значения operation.
+const (
+	OpGet    = "get"
+	OpSet    = "set"
+	OpDelete = "delete"
+)
+
+// Значения result для чтений из слоя кеша.
+const (
+	ResultHit   = "hit"
+	ResultStale = "stale" // значение устаревшее, см. Expiry.Stale
+	ResultMiss  = "miss"
+	ResultError = "error"
+)
+
+// durationBuckets - от десятков микросекунд (память процесса) до сотен миллисекунд (Redis под нагрузкой).
+var durationBuckets = []float64{.00005, .0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25}
+
+// Значения trigger: почему значение читается из базы.
+const (
+	TriggerMiss    = "miss"    // значения нет в кеше
+	TriggerRefresh = "refresh" // фоновое обновление устаревшего значения
+	TriggerError   = "error"   // кеш недоступен или вернул ошибку
+)
+
+// Значения reason: почему обращение к базе не понадобилось.
+const (
+	ReasonCoalesced = "coalesced" // запрос дождался чтения, начатого другим запросом
+	ReasonStale     = "stale"     // отдано устаревшее значение, обновление идёт в фоне
+)
+
+// cacheMetrics - обращения cachedRepository к базе и сэкономленные обращения.
+type cacheMetrics struct {
+	loads *prometheus.CounterVec
+	saved *prometheus.CounterVec
+}
+
+// newCacheMetrics создаёт счётчики и регистрирует их в reg.
+func newCacheMetrics(reg prometheus.Registerer, namespace string) (*cacheMetrics, error) {
+	m := &cacheMetrics{
+		loads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "db_loads_total",
+			Help:      "The number of values loaded from the database by the cached repository",
+		}, []string{LabelEntity, LabelTrigger}),
+		saved: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "db_loads_saved_total",
+			Help:      "The number of database loads avoided by request coalescing and stale reads",
+		}, []string{LabelEntity, LabelReason}),
+	}
+	for _, c := range []prometheus.Collector{m.loads, m.saved} {
+		if err := reg.Register(c); err != nil {
+			return nil, fmt.Errorf("register cache metrics: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// layerMetrics - обращения к слоям кеша (layer - SourceLocal или SourceRedis).
+type layerMetrics struct {
+	lookups  *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// newLayerMetrics создаёт метрики слоёв и регистрирует их в reg.
+func newLayerMetrics(reg prometheus.Registerer, namespace string) (*layerMetrics, error) {
+	m := &layerMetrics{
+		lookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "lookups_total",
+			Help:      "The number of cache reads by layer, key prefix and result",
+		}, []string{LabelLayer, LabelEntity, LabelResult}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "write_errors_total",
+			Help:      "The number of failed cache writes and deletes by layer and key prefix",
+		}, []string{LabelLayer, LabelEntity, LabelOperation}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "operation_duration_seconds",
+			Help:      "The duration of cache operations by layer",
+			Buckets:   durationBuckets,
+		}, []string{LabelLayer, LabelOperation}),
+	}
+	for _, c := range []prometheus.Collector{m.lookups, m.errors, m.duration} {
+		if err := reg.Register(c); err != nil {
+			return nil, fmt.Errorf("register cache metrics: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// breakerMetrics - состояние breakerCache по слоям.
+type breakerMetrics struct {
+	state       *prometheus.GaugeVec
+	transitions *prometheus.CounterVec
+}
+
+// newBreakerMetrics создаёт метрики breaker и регистрирует их в reg.
+func newBreakerMetrics(reg prometheus.Registerer, namespace string) (*breakerMetrics, error) {
+	m := &breakerMetrics{
+		state: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "breaker_state",
+			Help:      "The state of the cache circuit breaker: 0 - closed, 1 - half-open, 2 - open",
+		}, []string{LabelLayer}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "breaker_transitions_total",
+			Help:      "The number of cache circuit breaker state changes by the new state",
+		}, []string{LabelLayer, LabelState}),
+	}
+	for _, c := range []prometheus.Collector{m.state, m.transitions} {
+		if err := reg.Register(c); err != nil {
+			return nil, fmt.Errorf("register cache metrics: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// registerLocalSize регистрирует в reg число значений в памяти процесса.
+func registerLocalSize(reg prometheus.Registerer, namespace string, c *localCache) error {
+	g := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "local_entries",
+		Help:      "The number of values held by the in-process cache",
+	}, func() float64 {
+		return float64(c.Len())
+	})
+	if err := reg.Register(g); err != nil {
+		return fmt.Errorf("register cache metrics: %w", err)
+	}
+	return nil
+}
+
+// instrumentedCache ведёт метрики слоя layer.
+type instrumentedCache struct {
+	Cache
+	layer   string
+	metrics *layerMetrics
+}
+
+func instrument(c Cache, layer string, m *layerMetrics) Cache {
+	return instrumentedCache{Cache: c, layer: layer, metrics: m}
+}
+
+func (c instrumentedCache) Get(ctx context.Context, key string, dst interface{}) (Lookup, error) {
+	start := time.Now()
+	lk, err := c.Cache.Get(ctx, key, dst)
+	c.metrics.duration.WithLabelValues(c.layer, OpGet).Observe(time.Since(start).Seconds())
+	result := ResultHit
+	switch {
+	case err == ErrCacheMiss:
+		result = ResultMiss
+	case err != nil:
+		result = ResultError
+	case lk.Stale:
+		result = ResultStale
+	}
+	c.metrics.lookups.WithLabelValues(c.layer, string(entityOf(key)), result).Inc()
+	return lk, err
+}
+
+func (c instrumentedCache) Set(ctx context.Context, key string, value interface{}) error {
+	return c.write(OpSet, key, func() error {
+		return c.Cache.Set(ctx, key, value)
+	})
+}
+
+func (c instrumentedCache) Delete(ctx context.Context, key string) error {
+	return c.write(OpDelete, key, func() error {
+		return c.Cache.Delete(ctx, key)
+	})
+}
+
+func (c instrumentedCache) write(op, key string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	c.metrics.duration.WithLabelValues(c.layer, op).Observe(time.Since(start).Seconds())
+	if err != nil {
+		c.metrics.errors.WithLabelValues(c.layer, string(entityOf(key)), op).Inc()
+	}
+	return err
+}
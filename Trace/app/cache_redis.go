@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/cache/v8"
+	"github.com/go-redis/redis/v8"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newRedisClient - клиент Redis по rcfg, каждая команда создаёт спан.
+func newRedisClient(rcfg RedisConfig, tp trace.TracerProvider) *redis.Client {
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     rcfg.Addr,
+		Password: rcfg.Password,
+		DB:       rcfg.DB,
+	})
+	rdb.AddHook(redisHook{tracer: tp.Tracer(ServiceName)})
+	return rdb
+}
+
+// InvalidationChannel - канал Redis, в который публикуются удалённые из кеша ключи.
+const InvalidationChannel = "trace_app:cache:invalidate"
+
+// redisCache хранит значения в Redis, сжатием занимается go-redis/cache.
+type redisCache struct {
+	rdb    *redis.Client
+	cache  *cache.Cache
+	expiry Expiry
+}
+
+// redisEntry - значение и момент (unix, нс), после которого оно устаревшее.
+type redisEntry struct {
+	FreshUntil int64              `msgpack:"f"`
+	Value      msgpack.RawMessage `msgpack:"v"`
+}
+
+func newRedisCache(rdb *redis.Client, expiry Expiry) *redisCache {
+	return &redisCache{
+		rdb:    rdb,
+		cache:  cache.New(&cache.Options{Redis: rdb}),
+		expiry: expiry,
+	}
+}
+
+func (c *redisCache) Get(ctx context.Context, key string, dst interface{}) (Lookup, error) {
+	var e redisEntry
+	switch err := c.cache.Get(ctx, key, &e); err {
+	case nil:
+	case cache.ErrCacheMiss:
+		return Lookup{}, ErrCacheMiss
+	default:
+		return Lookup{}, err
+	}
+	// запись без значения - старого формата, она будет перезаписана
+	if len(e.Value) == 0 {
+		return Lookup{}, ErrCacheMiss
+	}
+	if err := msgpack.Unmarshal(e.Value, dst); err != nil {
+		return Lookup{}, err
+	}
+	return Lookup{Source: SourceRedis, Stale: time.Now().UnixNano() > e.FreshUntil}, nil
+}
+
+func (c *redisCache) Set(ctx context.Context, key string, value interface{}) error {
+	fresh, keep := c.expiry.ttl(key)
+	if keep <= 0 {
+		return nil
+	}
+	b, err := msgpack.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.cache.Set(&cache.Item{
+		Ctx:   ctx,
+		Key:   key,
+		Value: redisEntry{FreshUntil: time.Now().Add(fresh).UnixNano(), Value: b},
+		TTL:   keep,
+	})
+}
+
+// Delete удаляет key и публикует его в InvalidationChannel: подписчики сбрасывают
+// key в памяти своих процессов.
+func (c *redisCache) Delete(ctx context.Context, key string) error {
+	_, err := c.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.Publish(ctx, InvalidationChannel, key)
+		return nil
+	})
+	return err
+}
+
+// subscribe вызывает evict для каждого ключа из InvalidationChannel до отмены ctx.
+// go-redis переподключается сам; ключи, удалённые, пока соединения не было, живут
+// в памяти процессов до своего TTL.
+func (c *redisCache) subscribe(ctx context.Context, evict func(ctx context.Context, key string)) {
+	ps := c.rdb.Subscribe(ctx, InvalidationChannel)
+	go func() {
+		defer ps.Close()
+		ch := ps.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				evict(ctx, msg.Payload)
+			}
+		}
+	}()
+}
+
+func (c *redisCache) Ping(ctx context.Context) error {
+	return c.rdb.Ping(ctx).Err()
+}
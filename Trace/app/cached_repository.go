@@ -2,120 +2,404 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"reflect"
+	"sync"
 	"time"
 
-	"github.com/go-redis/cache/v8"
-	"github.com/go-redis/redis/v8"
+	"github.com/Deny7676yar/observability/pkg/logctx"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
+// Атрибуты спанов кеша.
+const (
+	CacheKeyKey    = attribute.Key("cache.key")
+	CacheHitKey    = attribute.Key("cache.hit")
+	CacheSourceKey = attribute.Key("cache.source")
+	CacheStaleKey  = attribute.Key("cache.stale")
+	// CacheInvalidatedKey - ключи, сброшенные после изменения.
+	CacheInvalidatedKey = attribute.Key("cache.invalidated")
+)
+
+// Значения cache.source: где нашлось значение.
+const (
+	SourceLocal = "local" // TinyLFU в памяти процесса, localCache
+	SourceRedis = "redis"
+	SourceDB    = "db" // промах кеша, значение прочитано из Postgres
+)
+
+// loadTimeout - предельное время чтения из базы, которого ждут несколько запросов
+// или которое идёт в фоне.
+const loadTimeout = 5 * time.Second
+
+// loadFunc читает значение из базы.
+type loadFunc func(ctx context.Context) (interface{}, error)
+
 type cachedRepository struct {
 	repository Repository
 	logger     *zap.Logger
-	cache      *cache.Cache
+	tracer     trace.Tracer
+	cache      Cache
+	metrics    *cacheMetrics
+	// loads объединяет одновременные чтения из базы одного ключа
+	loads singleflight.Group
+	// refreshing - ключи, которые сейчас обновляются в фоне
+	refreshing sync.Map
+
+	// gens - поколения ключей, которые сейчас читаются из базы, меняются при инвалидации
+	gensMu sync.Mutex
+	gens   map[string]*keyGen
 }
 
-func (r *cachedRepository) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
-	key := fmt.Sprintf("user:%s", id)
-	var user User
-	err := r.cache.Get(ctx, key, &user)
-	switch err {
-	case nil:
-		return &user, nil
-	case cache.ErrCacheMiss:
-		dbUser, dbErr := r.repository.GetUser(ctx, id)
-		if dbErr != nil {
-			return nil, dbErr
+// keyGen - поколение ключа и число идущих чтений, запись удаляется после последнего чтения.
+type keyGen struct {
+	gen   uint64
+	loads int
+}
+
+// beginLoad отмечает начало чтения key из базы и возвращает текущее поколение ключа.
+func (r *cachedRepository) beginLoad(key string) uint64 {
+	r.gensMu.Lock()
+	defer r.gensMu.Unlock()
+	g, ok := r.gens[key]
+	if !ok {
+		g = &keyGen{}
+		r.gens[key] = g
+	}
+	g.loads++
+	return g.gen
+}
+
+// invalidated - key инвалидирован после начала чтения с поколением gen.
+func (r *cachedRepository) invalidated(key string, gen uint64) bool {
+	r.gensMu.Lock()
+	defer r.gensMu.Unlock()
+	return r.gens[key].gen != gen
+}
+
+// endLoad отмечает конец чтения key.
+func (r *cachedRepository) endLoad(key string) {
+	r.gensMu.Lock()
+	defer r.gensMu.Unlock()
+	g := r.gens[key]
+	g.loads--
+	if g.loads == 0 {
+		delete(r.gens, key)
+	}
+}
+
+// cached читает key из кеша в dst. При промахе вызывает load и кладёт результат в кеш,
+// время жизни задаёт Expiry хранилища. Устаревшее значение отдаётся сразу и обновляется
+// в фоне. Если кеш недоступен, значение читается из базы. Спан метода получает атрибуты
+// cache.key, cache.hit, cache.source и cache.stale.
+func (r *cachedRepository) cached(ctx context.Context, span trace.Span, key string,
+	dst interface{}, load loadFunc) error {
+	span.SetAttributes(CacheKeyKey.String(key))
+	lk, err := r.cache.Get(ctx, key, dst)
+	if err == nil {
+		span.SetAttributes(CacheHitKey.Bool(true), CacheSourceKey.String(lk.Source), CacheStaleKey.Bool(lk.Stale))
+		if lk.Stale {
+			r.metrics.saved.WithLabelValues(string(entityOf(key)), ReasonStale).Inc()
+			r.refresh(ctx, key, load)
 		}
-		err = r.cache.Set(&cache.Item{
-			Ctx:   ctx,
-			Key:   key,
-			Value: dbUser,
-			TTL:   time.Hour,
-		})
+		return nil
+	}
+	trigger := TriggerMiss
+	if err != ErrCacheMiss {
+		trigger = TriggerError
+		r.cacheError(ctx, "cache read failed", key, err)
+	}
+	span.SetAttributes(CacheHitKey.Bool(false), CacheSourceKey.String(SourceDB))
+	v, err := r.load(ctx, key, trigger, load)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			spanError(span, err)
+		}
+		return err
+	}
+	// dst мог быть частично заполнен неудачным чтением из кеша
+	out := reflect.ValueOf(dst).Elem()
+	if v != nil {
+		out.Set(reflect.ValueOf(v))
+	} else {
+		out.Set(reflect.Zero(out.Type()))
+	}
+	return nil
+}
+
+// cacheError - ошибка кеша, которая не прерывает запрос: его обслуживает база.
+// Пока breaker открыт, ошибки не пишутся в лог: их видно по метрикам breaker.
+func (r *cachedRepository) cacheError(ctx context.Context, msg, key string, err error) {
+	trace.SpanFromContext(ctx).RecordError(err)
+	if errors.Is(err, ErrCacheUnavailable) {
+		return
+	}
+	logctx.Zap(ctx, r.logger).Warn(msg, zap.String("key", key), zap.Error(err))
+}
 
+// load читает key из базы и кладёт в кеш. Одновременные чтения одного ключа объединяются:
+// в базу идёт один запрос, остальные ждут его результата. Чтение не прерывается, если
+// первый запрос отменён: его результата ждут другие. Ошибка записи в кеш не возвращается.
+// Если key инвалидирован во время чтения, прочитанное значение могло устареть: оно
+// возвращается, но в кеше не остаётся.
+func (r *cachedRepository) load(ctx context.Context, key, trigger string, load loadFunc) (interface{}, error) {
+	entity := string(entityOf(key))
+	leader := false
+	ch := r.loads.DoChan(key, func() (interface{}, error) {
+		leader = true
+		r.metrics.loads.WithLabelValues(entity, trigger).Inc()
+		gen := r.beginLoad(key)
+		defer r.endLoad(key)
+		ctx, cancel := context.WithTimeout(detached{ctx}, loadTimeout)
+		defer cancel()
+		v, err := load(ctx)
 		if err != nil {
 			return nil, err
 		}
-		return dbUser, nil
+		if r.invalidated(key, gen) {
+			return v, nil
+		}
+		if err := r.cache.Set(ctx, key, v); err != nil {
+			r.cacheError(ctx, "cache write failed", key, err)
+		}
+		// инвалидация между проверкой и записью: её Delete мог пройти раньше Set
+		if r.invalidated(key, gen) {
+			if err := r.cache.Delete(ctx, key); err != nil {
+				r.cacheError(ctx, "cache invalidation failed", key, err)
+			}
+		}
+		return v, nil
+	})
+	select {
+	case res := <-ch:
+		if res.Shared && !leader {
+			r.metrics.saved.WithLabelValues(entity, ReasonCoalesced).Inc()
+		}
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	return nil, err
 }
 
-func (r *cachedRepository) GetUsersByName(ctx context.Context, name string) ([]*User, error) {
-	r.logger.Info("in get users by name")
-	key := fmt.Sprintf("users-name:%s", name)
-	var users []*User
-	err := r.cache.Get(ctx, key, &users)
-	switch err {
-	case nil:
-		return users, nil
-	case cache.ErrCacheMiss:
-		r.logger.Info("cache miss!")
-		dbUsers, dbErr := r.repository.GetUsersByName(ctx, name)
-		if dbErr != nil {
-			return nil, dbErr
+// refresh обновляет устаревшее значение key в фоне, не больше одного обновления на ключ.
+// Спан обновления - корневой, со ссылкой на спан запроса, который его запустил.
+func (r *cachedRepository) refresh(ctx context.Context, key string, load loadFunc) {
+	if _, busy := r.refreshing.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+	link := trace.LinkFromContext(ctx)
+	ctx = detached{ctx}
+	go func() {
+		defer r.refreshing.Delete(key)
+		ctx, span := r.tracer.Start(ctx, "cachedRepository.refresh",
+			trace.WithNewRoot(),
+			trace.WithLinks(link),
+			trace.WithAttributes(CacheKeyKey.String(key)),
+		)
+		defer span.End()
+		_, err := r.load(ctx, key, TriggerRefresh, load)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			// значения больше нет в базе: устаревшее не должно отдаваться дальше
+			err = r.cache.Delete(ctx, key)
+		case err != nil:
+			logctx.Zap(ctx, r.logger).Warn("cache refresh failed", zap.String("key", key), zap.Error(err))
 		}
-		err = r.cache.Set(&cache.Item{
-			Ctx:   ctx,
-			Key:   key,
-			Value: dbUsers,
-			TTL:   time.Second * 5,
-		})
 		if err != nil {
-			return nil, err
+			spanError(span, err)
 		}
-		return dbUsers, nil
+	}()
+}
+
+// detached - контекст со значениями (спан, request_id) исходного, но без его отмены.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detached) Done() <-chan struct{} { return nil }
+
+func (detached) Err() error { return nil }
+
+func (r *cachedRepository) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	ctx, span := r.tracer.Start(ctx, "cachedRepository.GetUser")
+	defer span.End()
+	var user *User
+	err := r.cached(ctx, span, EntityUser.Key(id.String()), &user,
+		func(ctx context.Context) (interface{}, error) {
+			return r.repository.GetUser(ctx, id)
+		})
+	if err != nil {
+		return nil, err
 	}
-	return nil, err
+	return user, nil
 }
 
+func (r *cachedRepository) GetUsersByName(ctx context.Context, name string) ([]*User, error) {
+	ctx, span := r.tracer.Start(ctx, "cachedRepository.GetUsersByName")
+	defer span.End()
+	logctx.Zap(ctx, r.logger).Info("in get users by name")
+	var users []*User
+	err := r.cached(ctx, span, EntityUsersByName.Key(name), &users,
+		func(ctx context.Context) (interface{}, error) {
+			logctx.Zap(ctx, r.logger).Info("cache miss!")
+			return r.repository.GetUsersByName(ctx, name)
+		})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetUsers не кешируется.
 func (r *cachedRepository) GetUsers(ctx context.Context) ([]User, error) {
-	return r.repository.GetUsers(ctx)
+	ctx, span := r.tracer.Start(ctx, "cachedRepository.GetUsers",
+		trace.WithAttributes(CacheSourceKey.String(SourceDB)))
+	defer span.End()
+	users, err := r.repository.GetUsers(ctx)
+	if err != nil {
+		spanError(span, err)
+	}
+	return users, err
 }
 
 func (r *cachedRepository) GetUserArticles(ctx context.Context, userID uuid.UUID) ([]Article, error) {
-	key := fmt.Sprintf("user_articles: %s", userID)
+	ctx, span := r.tracer.Start(ctx, "cachedRepository.GetUserArticles")
+	defer span.End()
 	var articles []Article
-	err := r.cache.Get(ctx, key, &articles)
-	switch err {
-	case nil:
-		return articles, nil
-	case cache.ErrCacheMiss:
-
-		dbArticles, dbErr := r.repository.GetUserArticles(ctx, userID)
-		if dbErr != nil {
-			return nil, dbErr
-		}
-		err = r.cache.Set(&cache.Item{
-			Ctx:   ctx,
-			Key:   key,
-			Value: dbArticles,
-			TTL:   time.Second * 5,
+	err := r.cached(ctx, span, EntityUserArticles.Key(userID.String()), &articles,
+		func(ctx context.Context) (interface{}, error) {
+			return r.repository.GetUserArticles(ctx, userID)
 		})
-		if err != nil {
-			return nil, err
+	if err != nil {
+		return nil, err
+	}
+	return articles, nil
+}
+
+// invalidate сбрасывает keys после изменения в базе. Изменение уже сохранено, поэтому
+// ошибки кеша не возвращаются, а пишутся в лог: значения доживут до своего TTL.
+// Начатые чтения этих ключей могли прочитать прежнее значение: новые запросы их не ждут,
+// а сами они не записывают результат в кеш.
+func (r *cachedRepository) invalidate(ctx context.Context, span trace.Span, keys ...string) {
+	span.SetAttributes(CacheInvalidatedKey.StringSlice(keys))
+	r.gensMu.Lock()
+	for _, key := range keys {
+		if g, ok := r.gens[key]; ok {
+			g.gen++
+		}
+	}
+	r.gensMu.Unlock()
+	for _, key := range keys {
+		r.loads.Forget(key)
+		if err := r.cache.Delete(ctx, key); err != nil {
+			logctx.Zap(ctx, r.logger).Warn("cache invalidation failed", zap.String("key", key), zap.Error(err))
+			span.RecordError(err)
 		}
-		return dbArticles, nil
 	}
-	return nil, err
 }
 
-func NewCachedRepository(repository Repository, logger *zap.Logger) *cachedRepository {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379",
-		Password: "", // no password set
-		DB:       0,  // use default DB
-	})
-	rCache := cache.New(&cache.Options{
-		Redis:      rdb,
-		LocalCache: cache.NewTinyLFU(1000, time.Minute),
-	})
+// writeSpanError отмечает спан изменения ошибкой: ErrNotFound - не ошибка спана.
+func writeSpanError(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		spanError(span, err)
+	}
+}
+
+func (r *cachedRepository) CreateUser(ctx context.Context, name string) (*User, error) {
+	ctx, span := r.tracer.Start(ctx, "cachedRepository.CreateUser")
+	defer span.End()
+	user, err := r.repository.CreateUser(ctx, name)
+	if err != nil {
+		writeSpanError(span, err)
+		return nil, err
+	}
+	r.invalidate(ctx, span, EntityUsersByName.Key(name))
+	return user, nil
+}
+
+func (r *cachedRepository) UpdateUser(ctx context.Context, id uuid.UUID, name string) (*User, error) {
+	ctx, span := r.tracer.Start(ctx, "cachedRepository.UpdateUser")
+	defer span.End()
+	old, err := r.repository.UpdateUser(ctx, id, name)
+	if err != nil {
+		writeSpanError(span, err)
+		return nil, err
+	}
+	r.invalidate(ctx, span, EntityUser.Key(id.String()),
+		EntityUsersByName.Key(old.Name), EntityUsersByName.Key(name))
+	return old, nil
+}
+
+func (r *cachedRepository) DeleteUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	ctx, span := r.tracer.Start(ctx, "cachedRepository.DeleteUser")
+	defer span.End()
+	old, err := r.repository.DeleteUser(ctx, id)
+	if err != nil {
+		writeSpanError(span, err)
+		return nil, err
+	}
+	r.invalidate(ctx, span, EntityUser.Key(id.String()),
+		EntityUsersByName.Key(old.Name), EntityUserArticles.Key(id.String()))
+	return old, nil
+}
+
+func (r *cachedRepository) CreateArticle(ctx context.Context, a Article) (*Article, error) {
+	ctx, span := r.tracer.Start(ctx, "cachedRepository.CreateArticle")
+	defer span.End()
+	article, err := r.repository.CreateArticle(ctx, a)
+	if err != nil {
+		writeSpanError(span, err)
+		return nil, err
+	}
+	r.invalidate(ctx, span, EntityUserArticles.Key(article.UserID.String()))
+	return article, nil
+}
+
+func (r *cachedRepository) UpdateArticle(ctx context.Context, a Article) (*Article, error) {
+	ctx, span := r.tracer.Start(ctx, "cachedRepository.UpdateArticle")
+	defer span.End()
+	article, err := r.repository.UpdateArticle(ctx, a)
+	if err != nil {
+		writeSpanError(span, err)
+		return nil, err
+	}
+	r.invalidate(ctx, span, EntityUserArticles.Key(article.UserID.String()))
+	return article, nil
+}
+
+func (r *cachedRepository) DeleteArticle(ctx context.Context, id uuid.UUID) (*Article, error) {
+	ctx, span := r.tracer.Start(ctx, "cachedRepository.DeleteArticle")
+	defer span.End()
+	old, err := r.repository.DeleteArticle(ctx, id)
+	if err != nil {
+		writeSpanError(span, err)
+		return nil, err
+	}
+	r.invalidate(ctx, span, EntityUserArticles.Key(old.UserID.String()))
+	return old, nil
+}
+
+// NewCachedRepository - repository с кешем c. Для тестов подходит localCache или noopCache.
+// Счётчики обращений к базе регистрируются в reg.
+func NewCachedRepository(repository Repository, c Cache, tp trace.TracerProvider, reg prometheus.Registerer,
+	logger *zap.Logger) (*cachedRepository, error) {
+	metrics, err := newCacheMetrics(reg, Namespace)
+	if err != nil {
+		return nil, err
+	}
 	return &cachedRepository{
 		repository: repository,
-		cache:      rCache,
+		cache:      c,
+		metrics:    metrics,
+		tracer:     tp.Tracer(ServiceName),
 		logger:     logger,
-	}
+		gens:       make(map[string]*keyGen),
+	}, nil
 }
@@ -0,0 +1,705 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(CachedRepositorySuite))
+
+type CachedRepositorySuite struct {
+	sr   *tracetest.SpanRecorder
+	tp   *sdktrace.TracerProvider
+	repo *fakeRepository
+}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+// fakeRepository - Repository в памяти, считает обращения к "базе".
+type fakeRepository struct {
+	mu    sync.Mutex
+	users map[uuid.UUID]*User
+	calls int
+	// gate, если задан, задерживает GetUsersByName до закрытия
+	gate chan struct{}
+	// userGate, если задан, задерживает ответ GetUser, уже прочитавшего пользователя
+	userGate chan struct{}
+}
+
+func (f *fakeRepository) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func (f *fakeRepository) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	f.mu.Lock()
+	f.calls++
+	u, ok := f.users[id]
+	gate := f.userGate
+	f.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return u, nil
+}
+
+func (f *fakeRepository) GetUsers(ctx context.Context) ([]User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return nil, nil
+}
+
+func (f *fakeRepository) GetUsersByName(ctx context.Context, name string) ([]*User, error) {
+	if f.gate != nil {
+		<-f.gate
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return []*User{{Name: name}}, nil
+}
+
+func (f *fakeRepository) GetUserArticles(ctx context.Context, userID uuid.UUID) ([]Article, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return nil, nil
+}
+
+func (f *fakeRepository) CreateUser(ctx context.Context, name string) (*User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	u := &User{ID: uuid.New(), Name: name}
+	f.users[u.ID] = u
+	return u, nil
+}
+
+func (f *fakeRepository) UpdateUser(ctx context.Context, id uuid.UUID, name string) (*User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	old, ok := f.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	f.users[id] = &User{ID: id, Name: name}
+	return old, nil
+}
+
+func (f *fakeRepository) DeleteUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	old, ok := f.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(f.users, id)
+	return old, nil
+}
+
+func (f *fakeRepository) CreateArticle(ctx context.Context, a Article) (*Article, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	a.ID = uuid.New()
+	return &a, nil
+}
+
+func (f *fakeRepository) UpdateArticle(ctx context.Context, a Article) (*Article, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return &a, nil
+}
+
+func (f *fakeRepository) DeleteArticle(ctx context.Context, id uuid.UUID) (*Article, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return &Article{ID: id}, nil
+}
+
+func (s *CachedRepositorySuite) SetUpTest(c *gc.C) {
+	s.sr = tracetest.NewSpanRecorder()
+	s.tp = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(s.sr))
+	s.repo = &fakeRepository{users: make(map[uuid.UUID]*User)}
+}
+
+var testExpiry = Expiry{TTL: TTLPolicy{
+	EntityUser:        time.Minute,
+	EntityUsersByName: 50 * time.Millisecond,
+}}
+
+// localOnly - кеш без Redis: только память процесса.
+func (s *CachedRepositorySuite) localOnly() *cachedRepository {
+	return s.withCache(newLocalCache(10, testExpiry))
+}
+
+func (s *CachedRepositorySuite) withCache(c Cache) *cachedRepository {
+	r, err := NewCachedRepository(s.repo, c, s.tp, prometheus.NewRegistry(), zap.NewNop())
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// remoteCache - localCache, который выдаёт себя за Redis.
+type remoteCache struct {
+	*localCache
+}
+
+func (c remoteCache) Get(ctx context.Context, key string, dst interface{}) (Lookup, error) {
+	lk, err := c.localCache.Get(ctx, key, dst)
+	lk.Source = SourceRedis
+	return lk, err
+}
+
+func attrs(kvs []attribute.KeyValue) map[attribute.Key]attribute.Value {
+	ret := make(map[attribute.Key]attribute.Value)
+	for _, kv := range kvs {
+		ret[kv.Key] = kv.Value
+	}
+	return ret
+}
+
+func (s *CachedRepositorySuite) TestMissThenLocalHit(c *gc.C) {
+	id := uuid.New()
+	s.repo.users[id] = &User{ID: id, Name: "gopher"}
+	r := s.localOnly()
+
+	for i := 0; i < 2; i++ {
+		u, err := r.GetUser(context.Background(), id)
+		c.Assert(err, gc.IsNil)
+		c.Assert(u.Name, gc.Equals, "gopher")
+	}
+	c.Assert(s.repo.calls, gc.Equals, 1)
+
+	ended := s.sr.Ended()
+	c.Assert(ended, gc.HasLen, 2)
+	miss, hit := attrs(ended[0].Attributes()), attrs(ended[1].Attributes())
+	c.Assert(ended[0].Name(), gc.Equals, "cachedRepository.GetUser")
+	c.Assert(miss[CacheHitKey].AsBool(), gc.Equals, false)
+	c.Assert(miss[CacheSourceKey].AsString(), gc.Equals, SourceDB)
+	c.Assert(miss[CacheKeyKey].AsString(), gc.Equals, "user:"+id.String())
+	c.Assert(hit[CacheHitKey].AsBool(), gc.Equals, true)
+	c.Assert(hit[CacheSourceKey].AsString(), gc.Equals, SourceLocal)
+}
+
+func (s *CachedRepositorySuite) TestNotFoundIsNotSpanError(c *gc.C) {
+	_, err := s.localOnly().GetUser(context.Background(), uuid.New())
+	c.Assert(err, gc.Equals, ErrNotFound)
+	c.Assert(s.sr.Ended()[0].Status().Code.String(), gc.Equals, "Unset")
+}
+
+func (s *CachedRepositorySuite) TestTieredReadsRemoteAndFillsLocal(c *gc.C) {
+	id := uuid.New()
+	s.repo.users[id] = &User{ID: id, Name: "gopher"}
+	remote := remoteCache{newLocalCache(10, testExpiry)}
+	r := s.withCache(newTieredCache(newLocalCache(10, testExpiry), remote))
+
+	// первый экземпляр сервиса прочитал пользователя из базы и положил в оба слоя
+	_, err := r.GetUser(context.Background(), id)
+	c.Assert(err, gc.IsNil)
+	// второй экземпляр: в памяти пусто, значение есть в "Redis"
+	r = s.withCache(newTieredCache(newLocalCache(10, testExpiry), remote))
+	for i := 0; i < 2; i++ {
+		u, err := r.GetUser(context.Background(), id)
+		c.Assert(err, gc.IsNil)
+		c.Assert(u.Name, gc.Equals, "gopher")
+	}
+	c.Assert(s.repo.calls, gc.Equals, 1)
+
+	var sources []string
+	for _, span := range s.sr.Ended() {
+		sources = append(sources, attrs(span.Attributes())[CacheSourceKey].AsString())
+	}
+	c.Assert(sources, gc.DeepEquals, []string{SourceDB, SourceRedis, SourceLocal})
+}
+
+func (s *CachedRepositorySuite) TestTTLPolicy(c *gc.C) {
+	ctx := context.Background()
+	r := s.localOnly()
+	// у статей в testExpiry нет времени жизни: не кешируются
+	for i := 0; i < 2; i++ {
+		_, err := r.GetUserArticles(ctx, uuid.New())
+		c.Assert(err, gc.IsNil)
+	}
+	c.Assert(s.repo.calls, gc.Equals, 2)
+
+	_, err := r.GetUsersByName(ctx, "gopher")
+	c.Assert(err, gc.IsNil)
+	_, err = r.GetUsersByName(ctx, "gopher")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.repo.calls, gc.Equals, 3)
+	time.Sleep(60 * time.Millisecond)
+	_, err = r.GetUsersByName(ctx, "gopher")
+	c.Assert(err, gc.IsNil)
+	c.Assert(s.repo.calls, gc.Equals, 4, gc.Commentf("expired by ttl"))
+}
+
+func (s *CachedRepositorySuite) TestNoopAlwaysReadsDB(c *gc.C) {
+	id := uuid.New()
+	s.repo.users[id] = &User{ID: id}
+	r := s.withCache(noopCache{})
+	for i := 0; i < 2; i++ {
+		_, err := r.GetUser(context.Background(), id)
+		c.Assert(err, gc.IsNil)
+	}
+	c.Assert(s.repo.calls, gc.Equals, 2)
+}
+
+func (s *CachedRepositorySuite) TestLocalCacheReplacesAndDeletes(c *gc.C) {
+	ctx := context.Background()
+	lc := newLocalCache(10, testExpiry)
+	key := EntityUser.Key("1")
+	c.Assert(lc.Set(ctx, key, &User{Name: "old"}), gc.IsNil)
+	c.Assert(lc.Set(ctx, key, &User{Name: "new"}), gc.IsNil)
+	var u *User
+	lk, err := lc.Get(ctx, key, &u)
+	c.Assert(err, gc.IsNil)
+	c.Assert(lk, gc.Equals, Lookup{Source: SourceLocal})
+	c.Assert(u.Name, gc.Equals, "new")
+
+	c.Assert(lc.Delete(ctx, key), gc.IsNil)
+	_, err = lc.Get(ctx, key, &u)
+	c.Assert(err, gc.Equals, ErrCacheMiss)
+}
+
+func (s *CachedRepositorySuite) TestNewCacheUnknownBackend(c *gc.C) {
+	_, err := NewCache(context.Background(), CacheConfig{Backend: "memcached"}, RedisConfig{}, s.tp, prometheus.NewRegistry())
+	c.Assert(err, gc.ErrorMatches, `unknown cache backend "memcached"`)
+	_, err = NewCache(context.Background(), CacheConfig{Backend: CacheNoop, TTLJitter: 1}, RedisConfig{}, s.tp, prometheus.NewRegistry())
+	c.Assert(err, gc.ErrorMatches, `cache ttl jitter must be .*`)
+}
+
+func (s *CachedRepositorySuite) TestCoalescedMisses(c *gc.C) {
+	s.repo.gate = make(chan struct{})
+	r := s.localOnly()
+	const n = 10
+	var wg sync.WaitGroup
+	results := make(chan []*User, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			users, err := r.GetUsersByName(context.Background(), "gopher")
+			c.Check(err, gc.IsNil)
+			results <- users
+		}()
+	}
+	// все запросы ждут первого чтения из базы
+	time.Sleep(50 * time.Millisecond)
+	close(s.repo.gate)
+	wg.Wait()
+	close(results)
+	for users := range results {
+		c.Assert(users, gc.HasLen, 1)
+		c.Assert(users[0].Name, gc.Equals, "gopher")
+	}
+
+	c.Assert(s.repo.count(), gc.Equals, 1)
+	entity := string(EntityUsersByName)
+	c.Assert(testutil.ToFloat64(r.metrics.loads.WithLabelValues(entity, TriggerMiss)), gc.Equals, 1.0)
+	c.Assert(testutil.ToFloat64(r.metrics.saved.WithLabelValues(entity, ReasonCoalesced)), gc.Equals, float64(n-1))
+}
+
+// waitRefreshed ждёт окончания фонового обновления key.
+func waitRefreshed(r *cachedRepository, key string) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, busy := r.refreshing.Load(key); !busy {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (s *CachedRepositorySuite) TestStaleWhileRevalidate(c *gc.C) {
+	id := uuid.New()
+	s.repo.users[id] = &User{ID: id, Name: "old"}
+	exp := Expiry{TTL: TTLPolicy{EntityUser: 20 * time.Millisecond}, Stale: time.Minute}
+	r := s.withCache(newLocalCache(10, exp))
+	ctx := context.Background()
+
+	_, err := r.GetUser(ctx, id)
+	c.Assert(err, gc.IsNil)
+	time.Sleep(30 * time.Millisecond)
+	s.repo.mu.Lock()
+	s.repo.users[id] = &User{ID: id, Name: "new"}
+	s.repo.mu.Unlock()
+
+	// устаревшее значение отдаётся сразу, обновление идёт в фоне
+	u, err := r.GetUser(ctx, id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(u.Name, gc.Equals, "old")
+	waitRefreshed(r, EntityUser.Key(id.String()))
+	c.Assert(s.repo.count(), gc.Equals, 2)
+	u, err = r.GetUser(ctx, id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(u.Name, gc.Equals, "new")
+
+	entity := string(EntityUser)
+	c.Assert(testutil.ToFloat64(r.metrics.saved.WithLabelValues(entity, ReasonStale)), gc.Equals, 1.0)
+	c.Assert(testutil.ToFloat64(r.metrics.loads.WithLabelValues(entity, TriggerRefresh)), gc.Equals, 1.0)
+	var stale []bool
+	for _, span := range s.sr.Ended() {
+		if span.Name() == "cachedRepository.GetUser" {
+			stale = append(stale, attrs(span.Attributes())[CacheStaleKey].AsBool())
+		}
+	}
+	c.Assert(stale, gc.DeepEquals, []bool{false, true, false})
+}
+
+func (s *CachedRepositorySuite) TestStaleRefreshDropsDeleted(c *gc.C) {
+	id := uuid.New()
+	s.repo.users[id] = &User{ID: id}
+	exp := Expiry{TTL: TTLPolicy{EntityUser: time.Millisecond}, Stale: time.Minute}
+	r := s.withCache(newLocalCache(10, exp))
+	ctx := context.Background()
+	_, err := r.GetUser(ctx, id)
+	c.Assert(err, gc.IsNil)
+	time.Sleep(5 * time.Millisecond)
+	s.repo.mu.Lock()
+	delete(s.repo.users, id)
+	s.repo.mu.Unlock()
+
+	_, err = r.GetUser(ctx, id)
+	c.Assert(err, gc.IsNil, gc.Commentf("stale value is served"))
+	waitRefreshed(r, EntityUser.Key(id.String()))
+	_, err = r.GetUser(ctx, id)
+	c.Assert(err, gc.Equals, ErrNotFound)
+}
+
+func (s *CachedRepositorySuite) TestJitter(c *gc.C) {
+	exp := Expiry{TTL: TTLPolicy{EntityUser: time.Minute}, Stale: time.Second, Jitter: 0.5}
+	key := EntityUser.Key("1")
+	for i := 0; i < 100; i++ {
+		fresh, keep := exp.ttl(key)
+		c.Assert(fresh > 30*time.Second && fresh <= time.Minute, gc.Equals, true, gc.Commentf("%s", fresh))
+		c.Assert(keep, gc.Equals, fresh+time.Second)
+	}
+	fresh, keep := exp.ttl(EntityUserArticles.Key("1"))
+	c.Assert(fresh, gc.Equals, time.Duration(0))
+	c.Assert(keep, gc.Equals, time.Duration(0))
+}
+
+func (s *CachedRepositorySuite) TestRedisHookCreatesChildSpan(c *gc.C) {
+	h := redisHook{tracer: s.tp.Tracer(ServiceName)}
+	ctx, parent := s.tp.Tracer("test").Start(context.Background(), "cachedRepository.GetUser")
+
+	cmd := redis.NewStringCmd(ctx, "get", "user:1")
+	cmd.SetErr(redis.Nil)
+	cctx, err := h.BeforeProcess(ctx, cmd)
+	c.Assert(err, gc.IsNil)
+	c.Assert(h.AfterProcess(cctx, cmd), gc.IsNil)
+	parent.End()
+
+	span := s.sr.Ended()[0]
+	c.Assert(span.Name(), gc.Equals, "redis get")
+	c.Assert(span.Parent().SpanID(), gc.Equals, parent.SpanContext().SpanID())
+	c.Assert(span.Status().Code.String(), gc.Equals, "Unset", gc.Commentf("redis.Nil is a miss, not an error"))
+}
+
+func (s *CachedRepositorySuite) TestLayerMetrics(c *gc.C) {
+	reg := prometheus.NewRegistry()
+	m, err := newLayerMetrics(reg, Namespace)
+	c.Assert(err, gc.IsNil)
+	lc := newLocalCache(10, testExpiry)
+	c.Assert(registerLocalSize(reg, Namespace, lc), gc.IsNil)
+	remote := remoteCache{newLocalCache(10, testExpiry)}
+	r := s.withCache(newTieredCache(instrument(lc, SourceLocal, m), instrument(remote, SourceRedis, m)))
+
+	id := uuid.New()
+	s.repo.users[id] = &User{ID: id}
+	for i := 0; i < 3; i++ {
+		_, err := r.GetUser(context.Background(), id)
+		c.Assert(err, gc.IsNil)
+	}
+	_, err = r.GetUsersByName(context.Background(), "gopher")
+	c.Assert(err, gc.IsNil)
+
+	user, byName := string(EntityUser), string(EntityUsersByName)
+	lookups := func(layer, entity, result string) float64 {
+		return testutil.ToFloat64(m.lookups.WithLabelValues(layer, entity, result))
+	}
+	c.Assert(lookups(SourceLocal, user, ResultMiss), gc.Equals, 1.0)
+	c.Assert(lookups(SourceLocal, user, ResultHit), gc.Equals, 2.0)
+	c.Assert(lookups(SourceRedis, user, ResultMiss), gc.Equals, 1.0)
+	c.Assert(lookups(SourceRedis, byName, ResultMiss), gc.Equals, 1.0)
+	c.Assert(testutil.ToFloat64(m.errors.WithLabelValues(SourceRedis, user, OpSet)), gc.Equals, 0.0)
+	c.Assert(lc.Len(), gc.Equals, 2)
+
+	const entries = `
+# HELP trace_app_cache_local_entries The number of values held by the in-process cache
+# TYPE trace_app_cache_local_entries gauge
+trace_app_cache_local_entries 2
+`
+	c.Assert(testutil.GatherAndCompare(reg, strings.NewReader(entries), "trace_app_cache_local_entries"), gc.IsNil)
+	n, err := testutil.GatherAndCount(reg, "trace_app_cache_operation_duration_seconds")
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 4, gc.Commentf("get and set for both layers"))
+}
+
+func (s *CachedRepositorySuite) TestWritesInvalidate(c *gc.C) {
+	ctx := context.Background()
+	exp := Expiry{TTL: TTLPolicy{
+		EntityUser:         time.Minute,
+		EntityUsersByName:  time.Minute,
+		EntityUserArticles: time.Minute,
+	}}
+	lc := newLocalCache(10, exp)
+	r := s.withCache(lc)
+	has := func(key string) bool {
+		var v interface{}
+		_, err := lc.Get(ctx, key, &v)
+		return err == nil
+	}
+
+	u, err := r.CreateUser(ctx, "old")
+	c.Assert(err, gc.IsNil)
+	id := u.ID.String()
+	_, err = r.GetUser(ctx, u.ID)
+	c.Assert(err, gc.IsNil)
+	_, err = r.GetUsersByName(ctx, "old")
+	c.Assert(err, gc.IsNil)
+	_, err = r.GetUsersByName(ctx, "new")
+	c.Assert(err, gc.IsNil)
+	_, err = r.GetUserArticles(ctx, u.ID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(has(EntityUser.Key(id)), gc.Equals, true)
+
+	old, err := r.UpdateUser(ctx, u.ID, "new")
+	c.Assert(err, gc.IsNil)
+	c.Assert(old.Name, gc.Equals, "old")
+	c.Assert(has(EntityUser.Key(id)), gc.Equals, false)
+	c.Assert(has(EntityUsersByName.Key("old")), gc.Equals, false)
+	c.Assert(has(EntityUsersByName.Key("new")), gc.Equals, false)
+	c.Assert(has(EntityUserArticles.Key(id)), gc.Equals, true)
+	got, err := r.GetUser(ctx, u.ID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(got.Name, gc.Equals, "new")
+
+	_, err = r.CreateArticle(ctx, Article{UserID: u.ID, Title: "t"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(has(EntityUserArticles.Key(id)), gc.Equals, false)
+
+	_, err = r.GetUserArticles(ctx, u.ID)
+	c.Assert(err, gc.IsNil)
+	_, err = r.GetUsersByName(ctx, "new")
+	c.Assert(err, gc.IsNil)
+	_, err = r.DeleteUser(ctx, u.ID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(lc.Len(), gc.Equals, 0)
+	_, err = r.GetUser(ctx, u.ID)
+	c.Assert(err, gc.Equals, ErrNotFound)
+
+	_, err = r.UpdateUser(ctx, u.ID, "again")
+	c.Assert(err, gc.Equals, ErrNotFound)
+	var invalidated []string
+	for _, span := range s.sr.Ended() {
+		if span.Name() == "cachedRepository.UpdateUser" {
+			c.Assert(span.Status().Code.String(), gc.Equals, "Unset")
+			if v, ok := attrs(span.Attributes())[CacheInvalidatedKey]; ok {
+				invalidated = v.AsStringSlice()
+			}
+		}
+	}
+	c.Assert(invalidated, gc.DeepEquals, []string{
+		EntityUser.Key(id), EntityUsersByName.Key("old"), EntityUsersByName.Key("new"),
+	})
+}
+
+func (s *CachedRepositorySuite) TestInvalidationDropsInflightLoad(c *gc.C) {
+	ctx := context.Background()
+	lc := newLocalCache(10, testExpiry)
+	r := s.withCache(lc)
+	u, err := s.repo.CreateUser(ctx, "old")
+	c.Assert(err, gc.IsNil)
+	s.repo.userGate = make(chan struct{})
+
+	loaded := make(chan *User)
+	go func() {
+		got, err := r.GetUser(ctx, u.ID)
+		c.Check(err, gc.IsNil)
+		loaded <- got
+	}()
+	for s.repo.count() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	_, err = r.UpdateUser(ctx, u.ID, "new")
+	c.Assert(err, gc.IsNil)
+	close(s.repo.userGate)
+	c.Assert((<-loaded).Name, gc.Equals, "old", gc.Commentf("the read started before the update"))
+
+	var cached User
+	_, err = lc.Get(ctx, EntityUser.Key(u.ID.String()), &cached)
+	c.Assert(err, gc.Equals, ErrCacheMiss, gc.Commentf("stale value written back: %+v", cached))
+	got, err := r.GetUser(ctx, u.ID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(got.Name, gc.Equals, "new")
+	c.Assert(r.gens, gc.HasLen, 0)
+}
+
+// failingCache - хранилище, которое недоступно, пока down.
+type failingCache struct {
+	mu    sync.Mutex
+	down  bool
+	calls int
+}
+
+func (f *failingCache) err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.down {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (f *failingCache) Get(ctx context.Context, key string, dst interface{}) (Lookup, error) {
+	if err := f.err(); err != nil {
+		return Lookup{}, err
+	}
+	return Lookup{}, ErrCacheMiss
+}
+
+func (f *failingCache) Set(ctx context.Context, key string, value interface{}) error { return f.err() }
+
+func (f *failingCache) Delete(ctx context.Context, key string) error { return f.err() }
+
+func (f *failingCache) Ping(ctx context.Context) error { return f.err() }
+
+// readOnlyCache - localCache, запись в который не удаётся.
+type readOnlyCache struct {
+	*localCache
+}
+
+func (c readOnlyCache) Set(ctx context.Context, key string, value interface{}) error {
+	return errors.New("out of memory")
+}
+
+func (s *CachedRepositorySuite) TestLocalWriteBackErrorKeepsRemoteHit(c *gc.C) {
+	ctx := context.Background()
+	m, err := newLayerMetrics(prometheus.NewRegistry(), Namespace)
+	c.Assert(err, gc.IsNil)
+	remote := remoteCache{newLocalCache(10, testExpiry)}
+	id := uuid.New()
+	key := EntityUser.Key(id.String())
+	c.Assert(remote.Set(ctx, key, &User{ID: id, Name: "gopher"}), gc.IsNil)
+	tc := newTieredCache(instrument(readOnlyCache{newLocalCache(10, testExpiry)}, SourceLocal, m), remote)
+
+	var u User
+	lk, err := tc.Get(ctx, key, &u)
+	c.Assert(err, gc.IsNil)
+	c.Assert(lk.Source, gc.Equals, SourceRedis)
+	c.Assert(u.Name, gc.Equals, "gopher")
+	c.Assert(testutil.ToFloat64(m.errors.WithLabelValues(SourceLocal, string(EntityUser), OpSet)), gc.Equals, 1.0)
+}
+
+func (s *CachedRepositorySuite) TestCacheErrorsFallBackToDB(c *gc.C) {
+	fc := &failingCache{down: true}
+	r := s.withCache(fc)
+	id := uuid.New()
+	s.repo.users[id] = &User{ID: id, Name: "gopher"}
+
+	u, err := r.GetUser(context.Background(), id)
+	c.Assert(err, gc.IsNil, gc.Commentf("cache read and write-back errors are not fatal"))
+	c.Assert(u.Name, gc.Equals, "gopher")
+	c.Assert(fc.calls, gc.Equals, 2)
+	c.Assert(testutil.ToFloat64(r.metrics.loads.WithLabelValues(string(EntityUser), TriggerError)), gc.Equals, 1.0)
+
+	spans := s.sr.Ended()
+	c.Assert(spans, gc.HasLen, 1)
+	c.Assert(spans[0].Status().Code.String(), gc.Equals, "Unset")
+	c.Assert(attrs(spans[0].Attributes())[CacheSourceKey].AsString(), gc.Equals, SourceDB)
+	c.Assert(spans[0].Events(), gc.HasLen, 2, gc.Commentf("read and write errors are recorded"))
+}
+
+func (s *CachedRepositorySuite) TestBreaker(c *gc.C) {
+	ctx := context.Background()
+	reg := prometheus.NewRegistry()
+	m, err := newBreakerMetrics(reg, Namespace)
+	c.Assert(err, gc.IsNil)
+	fc := &failingCache{down: true}
+	b := newBreakerCache(fc, SourceRedis, BreakerConfig{Failures: 2, OpenTimeout: 30 * time.Millisecond}, m)
+	state := func() float64 {
+		return testutil.ToFloat64(m.state.WithLabelValues(SourceRedis))
+	}
+
+	var v string
+	_, err = b.Get(ctx, "user:1", &v)
+	c.Assert(err, gc.ErrorMatches, "connection refused")
+	c.Assert(b.State(), gc.Equals, BreakerClosed)
+	c.Assert(b.Set(ctx, "user:1", v), gc.NotNil)
+	c.Assert(b.State(), gc.Equals, BreakerOpen)
+	c.Assert(state(), gc.Equals, float64(BreakerOpen))
+
+	// открытый breaker не обращается к хранилищу
+	_, err = b.Get(ctx, "user:1", &v)
+	c.Assert(err, gc.Equals, ErrCacheUnavailable)
+	c.Assert(fc.calls, gc.Equals, 2)
+	c.Assert(b.Ping(ctx), gc.ErrorMatches, "circuit breaker open: cache unavailable")
+
+	// пробная операция с ошибкой открывает breaker снова
+	time.Sleep(40 * time.Millisecond)
+	c.Assert(b.Ping(ctx), gc.ErrorMatches, "circuit breaker open: connection refused")
+	c.Assert(fc.calls, gc.Equals, 3)
+
+	time.Sleep(40 * time.Millisecond)
+	fc.mu.Lock()
+	fc.down = false
+	fc.mu.Unlock()
+	_, err = b.Get(ctx, "user:1", &v)
+	c.Assert(err, gc.Equals, ErrCacheMiss, gc.Commentf("a miss is a successful probe"))
+	c.Assert(b.State(), gc.Equals, BreakerClosed)
+	c.Assert(state(), gc.Equals, float64(BreakerClosed))
+	c.Assert(b.Ping(ctx), gc.IsNil)
+
+	transitions := func(s BreakerState) float64 {
+		return testutil.ToFloat64(m.transitions.WithLabelValues(SourceRedis, s.String()))
+	}
+	c.Assert(transitions(BreakerOpen), gc.Equals, 2.0)
+	c.Assert(transitions(BreakerHalfOpen), gc.Equals, 2.0)
+	c.Assert(transitions(BreakerClosed), gc.Equals, 1.0)
+}
+
+func (s *CachedRepositorySuite) TestBreakerProbesOnce(c *gc.C) {
+	m, err := newBreakerMetrics(prometheus.NewRegistry(), Namespace)
+	c.Assert(err, gc.IsNil)
+	b := newBreakerCache(&failingCache{}, SourceRedis, BreakerConfig{Failures: 1, OpenTimeout: time.Millisecond}, m)
+	b.open()
+	time.Sleep(5 * time.Millisecond)
+	probe, err := b.allow()
+	c.Assert(probe, gc.Equals, true)
+	c.Assert(err, gc.IsNil)
+	_, err = b.allow()
+	c.Assert(err, gc.Equals, ErrCacheUnavailable, gc.Commentf("one probe at a time"))
+	b.done(false, errors.New("started before the breaker opened"))
+	c.Assert(b.State(), gc.Equals, BreakerHalfOpen)
+	b.done(true, nil)
+	c.Assert(b.State(), gc.Equals, BreakerClosed)
+}
@@ -10,45 +10,61 @@ import (
 	"net/url"
 	"os"
 
+	"github.com/Deny7676yar/observability/pkg/config"
 	"github.com/jackc/pgtype"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-const (
-	PGUserName   = "gopher"
-	PGUserSecret = "P@ssw0rd"
-	PGHost       = "127.0.0.1"
-	PGPort       = "5432"
-	PGDatabase   = "app"
+// Config - параметры заполнения БД, загружаются config.FromEnv.
+// Имена переменных совпадают со стандартными переменными libpq.
+type Config struct {
+	PGUser     string `json:"pg_user" env:"PGUSER" default:"gopher"`
+	PGPassword string `json:"pg_password" env:"PGPASSWORD" default:"P@ssw0rd" secret:"true"`
+	PGHost     string `json:"pg_host" env:"PGHOST" default:"127.0.0.1"`
+	PGPort     string `json:"pg_port" env:"PGPORT" default:"5432"`
+	PGDatabase string `json:"pg_database" env:"PGDATABASE" default:"app"`
+
+	DataFile string `json:"data_file" env:"DATA_FILE" default:"data.json"`
+	Users    int    `json:"users" env:"USERS_TO_CREATE" default:"4000"`
+	Articles int    `json:"articles" env:"ARTICLES_TO_CREATE" default:"10000"`
+}
 
-	usersToCreate    = 4000
-	articlesToCreate = 10000
-)
+func (c *Config) Validate() error {
+	if c.Users < 1 || c.Articles < 0 {
+		return fmt.Errorf("bad counts: users %d, articles %d", c.Users, c.Articles)
+	}
+	return nil
+}
 
 func main() {
-	if err := run(); err != nil {
+	var cfg Config
+	if err := config.FromEnv(&cfg); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("config:", config.String(&cfg))
+	if err := run(cfg); err != nil {
 		log.Fatal(err)
 	}
 	log.Println("All done!")
 }
 
-func run() error {
-	data, err := parseDataFile()
+func run(cfg Config) error {
+	data, err := parseDataFile(cfg.DataFile)
 	if err != nil {
 		return fmt.Errorf("failed to parse the data file: %w", err)
 	}
 
-	pool, err := pgxpool.Connect(context.Background(), composeConnString())
+	pool, err := pgxpool.Connect(context.Background(), cfg.connString())
 	if err != nil {
 		return fmt.Errorf("failed to initialize a connection pool: %w", err)
 	}
 	defer pool.Close()
 
-	if err := fillUsersTable(context.Background(), pool, usersToCreate, data.Names); err != nil {
+	if err := fillUsersTable(context.Background(), pool, cfg.Users, data.Names); err != nil {
 		return fmt.Errorf("failed to fill the users table: %w", err)
 	}
-	if err := fillArticlesTable(context.Background(), pool, articlesToCreate, data); err != nil {
+	if err := fillArticlesTable(context.Background(), pool, cfg.Articles, data); err != nil {
 		return fmt.Errorf("failed to fill the articles table: %w", err)
 	}
 	return nil
@@ -60,8 +76,7 @@ type Data struct {
 	Shoes            []string `json:"shoes"`
 }
 
-func parseDataFile() (*Data, error) {
-	const dataFileName = "data.json"
+func parseDataFile(dataFileName string) (*Data, error) {
 	fileContents, err := os.ReadFile(dataFileName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read the data file %s: %w", dataFileName, err)
@@ -73,14 +88,14 @@ func parseDataFile() (*Data, error) {
 	return &data, nil
 }
 
-func composeConnString() string {
+func (c *Config) connString() string {
 	return fmt.Sprintf(
 		"postgresql://%s:%s@%s:%s/%s",
-		url.PathEscape(PGUserName),
-		url.PathEscape(PGUserSecret),
-		url.PathEscape(PGHost),
-		url.PathEscape(PGPort),
-		url.PathEscape(PGDatabase),
+		url.PathEscape(c.PGUser),
+		url.PathEscape(c.PGPassword),
+		url.PathEscape(c.PGHost),
+		url.PathEscape(c.PGPort),
+		url.PathEscape(c.PGDatabase),
 	)
 }
 
@@ -12,21 +12,42 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
-)
 
-const (
-	attackTime   = time.Second * 10
-	workersCount = 50
+	"github.com/Deny7676yar/observability/pkg/config"
+	"github.com/Deny7676yar/observability/pkg/requestid"
 )
 
+// Config - параметры нагрузки, загружаются config.FromEnv.
+type Config struct {
+	TargetURL  string        `json:"target_url" env:"TARGET_URL" default:"http://localhost:9000"`
+	AttackTime time.Duration `json:"attack_time" env:"ATTACK_TIME" default:"10s"`
+	Workers    int           `json:"workers" env:"WORKERS" default:"50"`
+	DataFile   string        `json:"data_file" env:"DATA_FILE" default:"../init-db/data.json"`
+}
+
+func (c *Config) Validate() error {
+	if c.Workers < 1 {
+		return fmt.Errorf("workers must be positive, got %d", c.Workers)
+	}
+	if c.AttackTime <= 0 {
+		return fmt.Errorf("attack_time must be positive, got %s", c.AttackTime)
+	}
+	return nil
+}
+
 func main() {
-	if err := run(); err != nil {
+	var cfg Config
+	if err := config.FromEnv(&cfg); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("config:", config.String(&cfg))
+	if err := run(cfg); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func run() error {
-	data, err := parseDataFile()
+func run(cfg Config) error {
+	data, err := parseDataFile(cfg.DataFile)
 	if err != nil {
 		return fmt.Errorf("failed to parse the data file: %w", err)
 	}
@@ -35,8 +56,10 @@ func run() error {
 	var opsCount uint64
 
 	startAt := time.Now()
-	stopAt := startAt.Add(attackTime)
+	stopAt := startAt.Add(cfg.AttackTime)
 
+	// у каждого запроса свой X-Request-ID, по нему запрос находится в логах сервиса
+	client := &http.Client{Transport: &requestid.Transport{Generate: true}}
 	attacker := func(stopAt time.Time) {
 		for {
 			if time.Now().After(stopAt) {
@@ -46,7 +69,7 @@ func run() error {
 			if err != nil {
 				continue
 			}
-			resp, err := http.Get(fmt.Sprintf("http://localhost:9000/users/name/%s", url.PathEscape(name)))
+			resp, err := client.Get(fmt.Sprintf("%s/users/name/%s", cfg.TargetURL, url.PathEscape(name)))
 			if err != nil {
 				continue
 			}
@@ -55,7 +78,7 @@ func run() error {
 		}
 	}
 
-	for i := 0; i < workersCount; i++ {
+	for i := 0; i < cfg.Workers; i++ {
 		wg.Add(1)
 		go func() {
 			attacker(stopAt)
@@ -74,8 +97,7 @@ type Data struct {
 	mux   *sync.RWMutex `json:"-"`
 }
 
-func parseDataFile() (*Data, error) {
-	const dataFileName = "../init-db/data.json"
+func parseDataFile(dataFileName string) (*Data, error) {
 	fileContents, err := os.ReadFile(dataFileName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read the data file %s: %w", dataFileName, err)
@@ -4,8 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/Deny7676yar/observability/pkg/dbmetrics"
 	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -13,18 +17,32 @@ const (
 	UsersSelect        = `SELECT id, name FROM users`
 	UserByIDSelect     = `SELECT id, name FROM users WHERE id = $1`
 	UserArticlesSelect = `SELECT id, title, text, user_id FROM articles WHERE user_id = $1`
+
+	UserInsert = `INSERT INTO users(name) VALUES($1) RETURNING id`
+	// UserUpdate возвращает прежнее имя: old - строка до изменения
+	UserUpdate         = `UPDATE users u SET name = $2 FROM users old WHERE u.id = $1 AND old.id = u.id RETURNING old.name`
+	UserDelete         = `DELETE FROM users WHERE id = $1 RETURNING name`
+	UserArticlesDelete = `DELETE FROM articles WHERE user_id = $1`
+	ArticleInsert      = `INSERT INTO articles(user_id, title, text) VALUES($1, $2, $3) RETURNING id`
+	ArticleUpdate      = `UPDATE articles SET title = $2, text = $3 WHERE id = $1 RETURNING user_id`
+	ArticleDelete      = `DELETE FROM articles WHERE id = $1 RETURNING user_id`
 )
 
+// pgForeignKeyViolation - код ошибки Postgres: статья ссылается на несуществующего пользователя.
+const pgForeignKeyViolation = "23503"
+
 var (
 	ErrNotFound      = errors.New("not found")
 	ErrMultipleFound = errors.New("multiple found")
 )
 
 type repository struct {
-	pool *pgxpool.Pool
+	pool    *pgxpool.Pool
+	metrics *dbmetrics.Collector
 }
 
-func (r *repository) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
+func (r *repository) GetUser(ctx context.Context, id uuid.UUID) (_ *User, err error) {
+	defer r.metrics.Observe("GetUser", time.Now(), &err)
 	rows, _ := r.pool.Query(ctx, UserByIDSelect, id)
 	var (
 		user  User
@@ -48,7 +66,8 @@ func (r *repository) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
 	return &user, nil
 }
 
-func (r *repository) GetUsersByName(ctx context.Context, name string) ([]*User, error) {
+func (r *repository) GetUsersByName(ctx context.Context, name string) (_ []*User, err error) {
+	defer r.metrics.Observe("GetUsersByName", time.Now(), &err)
 	rows, err := r.pool.Query(ctx, `SELECT id, name FROM users WHERE name = $1`, name)
 	if err != nil {
 		return nil, fmt.Errorf("DB query failed: %w", err)
@@ -65,7 +84,8 @@ func (r *repository) GetUsersByName(ctx context.Context, name string) ([]*User,
 	return users, nil
 }
 
-func (r *repository) GetUsers(ctx context.Context) ([]User, error) {
+func (r *repository) GetUsers(ctx context.Context) (_ []User, err error) {
+	defer r.metrics.Observe("GetUsers", time.Now(), &err)
 	rows, _ := r.pool.Query(ctx, UsersSelect)
 	ret := make([]User, 0)
 	for rows.Next() {
@@ -81,7 +101,8 @@ func (r *repository) GetUsers(ctx context.Context) ([]User, error) {
 	return ret, nil
 }
 
-func (r *repository) GetUserArticles(ctx context.Context, userID uuid.UUID) ([]Article, error) {
+func (r *repository) GetUserArticles(ctx context.Context, userID uuid.UUID) (_ []Article, err error) {
+	defer r.metrics.Observe("GetUserArticles", time.Now(), &err)
 	rows, _ := r.pool.Query(ctx, UserArticlesSelect, userID)
 	ret := make([]Article, 0)
 	for rows.Next() {
@@ -98,6 +119,78 @@ func (r *repository) GetUserArticles(ctx context.Context, userID uuid.UUID) ([]A
 	return ret, nil
 }
 
-func NewRepository(pool *pgxpool.Pool) *repository {
-	return &repository{pool: pool}
+func (r *repository) CreateUser(ctx context.Context, name string) (_ *User, err error) {
+	defer r.metrics.Observe("CreateUser", time.Now(), &err)
+	user := User{Name: name}
+	if err := r.pool.QueryRow(ctx, UserInsert, name).Scan(&user.ID); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *repository) UpdateUser(ctx context.Context, id uuid.UUID, name string) (_ *User, err error) {
+	defer r.metrics.Observe("UpdateUser", time.Now(), &err)
+	old := User{ID: id}
+	if err := r.pool.QueryRow(ctx, UserUpdate, id, name).Scan(&old.Name); err != nil {
+		return nil, notFound(err, "user id %s", id)
+	}
+	return &old, nil
+}
+
+// DeleteUser удаляет пользователя вместе с его статьями.
+func (r *repository) DeleteUser(ctx context.Context, id uuid.UUID) (_ *User, err error) {
+	defer r.metrics.Observe("DeleteUser", time.Now(), &err)
+	old := User{ID: id}
+	err = r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, UserArticlesDelete, id); err != nil {
+			return err
+		}
+		return tx.QueryRow(ctx, UserDelete, id).Scan(&old.Name)
+	})
+	if err != nil {
+		return nil, notFound(err, "user id %s", id)
+	}
+	return &old, nil
+}
+
+func (r *repository) CreateArticle(ctx context.Context, a Article) (_ *Article, err error) {
+	defer r.metrics.Observe("CreateArticle", time.Now(), &err)
+	if err := r.pool.QueryRow(ctx, ArticleInsert, a.UserID, a.Title, a.Text).Scan(&a.ID); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation {
+			return nil, fmt.Errorf("%w: user id %s", ErrNotFound, a.UserID)
+		}
+		return nil, err
+	}
+	return &a, nil
+}
+
+// UpdateArticle меняет заголовок и текст статьи a.ID, автор статьи не меняется.
+func (r *repository) UpdateArticle(ctx context.Context, a Article) (_ *Article, err error) {
+	defer r.metrics.Observe("UpdateArticle", time.Now(), &err)
+	if err := r.pool.QueryRow(ctx, ArticleUpdate, a.ID, a.Title, a.Text).Scan(&a.UserID); err != nil {
+		return nil, notFound(err, "article id %s", a.ID)
+	}
+	return &a, nil
+}
+
+func (r *repository) DeleteArticle(ctx context.Context, id uuid.UUID) (_ *Article, err error) {
+	defer r.metrics.Observe("DeleteArticle", time.Now(), &err)
+	old := Article{ID: id}
+	if err := r.pool.QueryRow(ctx, ArticleDelete, id).Scan(&old.UserID); err != nil {
+		return nil, notFound(err, "article id %s", id)
+	}
+	return &old, nil
+}
+
+// notFound заменяет pgx.ErrNoRows на ErrNotFound с описанием format.
+func notFound(err error, format string, args ...interface{}) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: "+format, append([]interface{}{ErrNotFound}, args...)...)
+	}
+	return err
+}
+
+func NewRepository(pool *pgxpool.Pool, metrics *dbmetrics.Collector) *repository {
+	return &repository{pool: pool, metrics: metrics}
 }
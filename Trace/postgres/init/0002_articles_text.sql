@@ -0,0 +1,4 @@
+\c app
+SET ROLE gopher;
+
+ALTER TABLE articles ADD COLUMN IF NOT EXISTS text text NOT NULL DEFAULT '';
@@ -0,0 +1,154 @@
+// Package dbmetrics - Prometheus-метрики пула соединений и запросов репозиториев.
+package dbmetrics
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	LabelDB    = "db"
+	LabelQuery = "query"
+)
+
+// PoolStats - снимок состояния пула, общий для database/sql и pgxpool.
+type PoolStats struct {
+	Open      int
+	Idle      int
+	InUse     int
+	WaitCount int64
+	// WaitDuration - суммарное время получения соединений из пула.
+	WaitDuration time.Duration
+}
+
+// StatsFunc возвращает текущее состояние пула, вызывается при каждом сборе метрик.
+type StatsFunc func() PoolStats
+
+// SQLStats - статистика пула database/sql.
+func SQLStats(db *sql.DB) StatsFunc {
+	return func() PoolStats {
+		st := db.Stats()
+		return PoolStats{
+			Open:         st.OpenConnections,
+			Idle:         st.Idle,
+			InUse:        st.InUse,
+			WaitCount:    st.WaitCount,
+			WaitDuration: st.WaitDuration,
+		}
+	}
+}
+
+// PgxPoolStats - статистика pgxpool. Ожиданием считаются захваты соединения при пустом пуле.
+// Отдельно время ожидания pgxpool не считает, поэтому WaitDuration - время всех захватов,
+// включая те, что соединения не ждали.
+func PgxPoolStats(pool *pgxpool.Pool) StatsFunc {
+	return func() PoolStats {
+		st := pool.Stat()
+		return PoolStats{
+			Open:         int(st.TotalConns()),
+			Idle:         int(st.IdleConns()),
+			InUse:        int(st.AcquiredConns()),
+			WaitCount:    st.EmptyAcquireCount(),
+			WaitDuration: st.AcquireDuration(),
+		}
+	}
+}
+
+// Collector собирает метрики пула и запросов одной базы.
+// Нулевой *Collector допустим: Observe на nil ничего не делает.
+type Collector struct {
+	stats    StatsFunc
+	db       string
+	notFound []error
+
+	open, idle, inUse, waitCount, waitDuration *prometheus.Desc
+
+	queryDuration *prometheus.HistogramVec
+	queryErrors   *prometheus.CounterVec
+}
+
+var _ prometheus.Collector = &Collector{}
+
+// NewCollector создаёт коллектор для базы db. Зарегистрировать его нужно отдельно.
+// notFound - ошибки "не найдено" репозитория, как и sql.ErrNoRows, они не считаются
+// ошибками запросов.
+func NewCollector(namespace, db string, stats StatsFunc, notFound ...error) *Collector {
+	constLabels := prometheus.Labels{LabelDB: db}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, constLabels)
+	}
+	return &Collector{
+		stats:        stats,
+		db:           db,
+		notFound:     notFound,
+		open:         desc("open_connections", "The number of established connections, both in use and idle"),
+		idle:         desc("idle_connections", "The number of idle connections"),
+		inUse:        desc("in_use_connections", "The number of connections currently in use"),
+		waitCount:    desc("wait_count_total", "The total number of connections waited for"),
+		waitDuration: desc("wait_duration_seconds_total", "The total time spent acquiring connections from the pool"),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   "db",
+			Name:        "query_duration_seconds",
+			Help:        "The distribution of repository query latencies",
+			Buckets:     []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+			ConstLabels: constLabels,
+		}, []string{LabelQuery}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "db",
+			Name:        "query_errors_total",
+			Help:        "The number of failed repository queries",
+			ConstLabels: constLabels,
+		}, []string{LabelQuery}),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.open
+	ch <- c.idle
+	ch <- c.inUse
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	c.queryDuration.Describe(ch)
+	c.queryErrors.Describe(ch)
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	st := c.stats()
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(st.Open))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(st.Idle))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(st.InUse))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(st.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, st.WaitDuration.Seconds())
+	c.queryDuration.Collect(ch)
+	c.queryErrors.Collect(ch)
+}
+
+// Observe учитывает запрос query, начатый в start. Удобно вызывать через defer
+// с именованным результатом: defer m.Observe("GetUser", time.Now(), &err).
+// "Не найдено" (sql.ErrNoRows, pgx.ErrNoRows и ошибки notFound из NewCollector)
+// ошибкой запроса не считается.
+func (c *Collector) Observe(query string, start time.Time, errp *error) {
+	if c == nil {
+		return
+	}
+	c.queryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+	if errp == nil || *errp == nil {
+		return
+	}
+	if errors.Is(*errp, sql.ErrNoRows) || errors.Is(*errp, pgx.ErrNoRows) {
+		return
+	}
+	for _, nf := range c.notFound {
+		if errors.Is(*errp, nf) {
+			return
+		}
+	}
+	c.queryErrors.WithLabelValues(query).Inc()
+}
@@ -0,0 +1,61 @@
+package dbmetrics
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(CollectorSuite))
+
+type CollectorSuite struct{}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *CollectorSuite) TestPoolAndQueryMetrics(c *gc.C) {
+	errNotFound := errors.New("not found")
+	col := NewCollector("test", "links", func() PoolStats {
+		return PoolStats{Open: 3, Idle: 1, InUse: 2, WaitCount: 7, WaitDuration: 1500 * time.Millisecond}
+	}, errNotFound)
+	reg := prometheus.NewRegistry()
+	c.Assert(reg.Register(col), gc.IsNil)
+
+	failed := errors.New("connection reset")
+	var noErr error
+	col.Observe("Create", time.Now(), &noErr)
+	col.Observe("Create", time.Now(), &failed)
+	notFound := sql.ErrNoRows
+	col.Observe("ReadLinkRank", time.Now(), &notFound)
+	noUser := fmt.Errorf("%w: user id 42", errNotFound)
+	col.Observe("GetUser", time.Now(), &noUser)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP test_db_pool_in_use_connections The number of connections currently in use
+# TYPE test_db_pool_in_use_connections gauge
+test_db_pool_in_use_connections{db="links"} 2
+# HELP test_db_pool_wait_duration_seconds_total The total time spent acquiring connections from the pool
+# TYPE test_db_pool_wait_duration_seconds_total counter
+test_db_pool_wait_duration_seconds_total{db="links"} 1.5
+# HELP test_db_query_errors_total The number of failed repository queries
+# TYPE test_db_query_errors_total counter
+test_db_query_errors_total{db="links",query="Create"} 1
+`), "test_db_pool_in_use_connections", "test_db_pool_wait_duration_seconds_total", "test_db_query_errors_total")
+	c.Assert(err, gc.IsNil)
+	c.Assert(testutil.ToFloat64(col.queryErrors.WithLabelValues("GetUser")), gc.Equals, 0.0)
+	c.Assert(testutil.CollectAndCount(col.queryDuration), gc.Equals, 3)
+}
+
+func (s *CollectorSuite) TestNilCollectorIsNoop(c *gc.C) {
+	var col *Collector
+	err := errors.New("boom")
+	col.Observe("Create", time.Now(), &err)
+}
@@ -0,0 +1,121 @@
+// Package ecslog - логи в формате Elastic Common Schema (ECS) для zap и logrus.
+// Записи пишутся одной JSON-строкой: @timestamp, log.level, message, service.name,
+// ecs.version, а поля сервисов переименовываются в поля ECS (trace_id - trace.id,
+// method - http.request.method и т.д., см. FieldNames). Вывод - stdout или файл с
+// ротацией по размеру и возрасту, который читает Fluent Bit (Elastic_stack/efk).
+// IndexTemplate и IngestPipeline генерируют настройки Elasticsearch под эти поля.
+package ecslog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Deny7676yar/observability/pkg/logctx"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Version - версия ECS, поле ecs.version.
+const Version = "1.6.0"
+
+// Поля ECS, которые добавляются в каждую запись.
+const (
+	TimestampKey = "@timestamp"
+	LevelKey     = "log.level"
+	MessageKey   = "message"
+	ServiceKey   = "service.name"
+	VersionKey   = "ecs.version"
+	ErrorKey     = "error.message"
+	ErrorTypeKey = "error.type"
+)
+
+// Форматы вывода.
+const (
+	FormatECS     = "ecs"
+	FormatConsole = "console"
+)
+
+// FieldNames - поля записей сервисов и соответствующие им поля ECS. Остальные поля
+// пишутся как есть.
+var FieldNames = map[string]string{
+	logctx.TraceIDKey:   "trace.id",
+	logctx.SpanIDKey:    "span.id",
+	logctx.RequestIDKey: "http.request.id",
+	logctx.PanicKey:     ErrorKey,
+	"error":             ErrorKey,
+	"stack":             "error.stack_trace",
+	"method":            "http.request.method",
+	"path":              "url.path",
+	"url":               "url.full",
+	"status":            "http.response.status_code",
+	"duration":          "event.duration",
+	"remote_addr":       "client.address",
+	"user_agent":        "user_agent.original",
+	"logger":            "log.logger",
+}
+
+// fieldName - имя поля ECS для key.
+func fieldName(key string) string {
+	if name, ok := FieldNames[key]; ok {
+		return name
+	}
+	return key
+}
+
+// Config - настройки логов, встраиваются в Config сервиса.
+type Config struct {
+	// Format - FormatECS или FormatConsole (zap: читаемый вывод для разработки).
+	Format string `json:"format" env:"LOG_FORMAT" default:"ecs"`
+	Level  string `json:"level" env:"LOG_LEVEL" default:"debug"`
+	// File - файл логов с ротацией; пусто - stdout.
+	File string `json:"file" env:"LOG_FILE"`
+	// MaxSizeMB - размер файла, после которого он ротируется.
+	MaxSizeMB int `json:"max_size_mb" env:"LOG_MAX_SIZE_MB" default:"100"`
+	// MaxAgeDays и MaxBackups - сколько дней и сколько старых файлов хранить, 0 - без ограничения.
+	MaxAgeDays int `json:"max_age_days" env:"LOG_MAX_AGE_DAYS" default:"7"`
+	MaxBackups int `json:"max_backups" env:"LOG_MAX_BACKUPS" default:"5"`
+}
+
+// Validate проверяет формат, уровень и параметры ротации.
+func (c Config) Validate() error {
+	switch c.Format {
+	case FormatECS, FormatConsole:
+	default:
+		return fmt.Errorf("log format must be %q or %q", FormatECS, FormatConsole)
+	}
+	if _, err := c.level(); err != nil {
+		return err
+	}
+	if c.MaxSizeMB <= 0 {
+		return errors.New("log max_size_mb must be positive")
+	}
+	if c.MaxAgeDays < 0 || c.MaxBackups < 0 {
+		return errors.New("log max_age_days and max_backups must not be negative")
+	}
+	return nil
+}
+
+func (c Config) level() (zapcore.Level, error) {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(c.Level)); err != nil {
+		return l, fmt.Errorf("log level: %w", err)
+	}
+	return l, nil
+}
+
+// Writer - куда писать записи: stdout или файл File с ротацией. Старые файлы сжимаются,
+// Fluent Bit читает только текущий.
+func (c Config) Writer() io.Writer {
+	if c.File == "" {
+		return os.Stdout
+	}
+	return &lumberjack.Logger{
+		Filename:   c.File,
+		MaxSize:    c.MaxSizeMB,
+		MaxAge:     c.MaxAgeDays,
+		MaxBackups: c.MaxBackups,
+		Compress:   true,
+	}
+}
@@ -0,0 +1,143 @@
+package ecslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Deny7676yar/observability/pkg/config"
+	"github.com/Deny7676yar/observability/pkg/logctx"
+	"github.com/Deny7676yar/observability/pkg/requestid"
+	"github.com/sirupsen/logrus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(ECSSuite))
+
+type ECSSuite struct{}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func decode(c *gc.C, line []byte) map[string]interface{} {
+	var m map[string]interface{}
+	c.Assert(json.Unmarshal(line, &m), gc.IsNil, gc.Commentf("%s", line))
+	return m
+}
+
+func (s *ECSSuite) TestZap(c *gc.C) {
+	var buf bytes.Buffer
+	l := zap.New(NewZapCore(zapcore.AddSync(&buf), zapcore.DebugLevel, "trace-app"))
+	tp := sdktrace.NewTracerProvider()
+	ctx, sp := tp.Tracer("test").Start(requestid.NewContext(context.Background(), "req-1"), "handler")
+	logctx.Zap(ctx, l).Error("panic recovered",
+		zap.String("method", "GET"),
+		zap.String("path", "/users/1"),
+		zap.Error(errors.New("timeout")),
+		zap.String("user", "42"),
+	)
+	sp.End()
+
+	m := decode(c, buf.Bytes())
+	c.Assert(m[TimestampKey], gc.NotNil)
+	c.Assert(m[LevelKey], gc.Equals, "error")
+	c.Assert(m[MessageKey], gc.Equals, "panic recovered")
+	c.Assert(m[ServiceKey], gc.Equals, "trace-app")
+	c.Assert(m[VersionKey], gc.Equals, Version)
+	c.Assert(m["trace.id"], gc.Equals, sp.SpanContext().TraceID().String())
+	c.Assert(m["span.id"], gc.Equals, sp.SpanContext().SpanID().String())
+	c.Assert(m["http.request.id"], gc.Equals, "req-1")
+	c.Assert(m["http.request.method"], gc.Equals, "GET")
+	c.Assert(m["url.path"], gc.Equals, "/users/1")
+	c.Assert(m[ErrorKey], gc.Equals, "timeout")
+	c.Assert(m[ErrorTypeKey], gc.Equals, "*errors.errorString")
+	c.Assert(m["user"], gc.Equals, "42")
+	c.Assert(m["trace_id"], gc.IsNil)
+	c.Assert(m["error"], gc.IsNil)
+}
+
+func (s *ECSSuite) TestLogrus(c *gc.C) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetFormatter(LogrusFormatter{Service: "shortener"})
+	l.WithFields(logrus.Fields{
+		logctx.RequestIDKey: "req-2",
+		"status":            500,
+		"alias":             "go",
+	}).WithError(errors.New("duplicate key")).Warn("create link failed")
+
+	m := decode(c, buf.Bytes())
+	c.Assert(m[LevelKey], gc.Equals, "warning")
+	c.Assert(m[MessageKey], gc.Equals, "create link failed")
+	c.Assert(m[ServiceKey], gc.Equals, "shortener")
+	c.Assert(m["http.request.id"], gc.Equals, "req-2")
+	c.Assert(m["http.response.status_code"], gc.Equals, 500.0)
+	c.Assert(m[ErrorKey], gc.Equals, "duplicate key")
+	c.Assert(m["alias"], gc.Equals, "go")
+}
+
+func (s *ECSSuite) TestConfigAndFile(c *gc.C) {
+	var cfg Config
+	c.Assert(config.Load(&cfg, ""), gc.IsNil)
+	c.Assert(cfg.Validate(), gc.IsNil)
+	c.Assert(cfg.Writer(), gc.Equals, os.Stdout)
+
+	bad := cfg
+	bad.Level = "loud"
+	c.Assert(bad.Validate(), gc.ErrorMatches, "log level: .*")
+	bad = cfg
+	bad.Format = "xml"
+	c.Assert(bad.Validate(), gc.ErrorMatches, "log format .*")
+
+	cfg.File = filepath.Join(c.MkDir(), "app.log")
+	cfg.Level = "info"
+	l, err := NewZap(cfg, "example")
+	c.Assert(err, gc.IsNil)
+	l.Debug("skipped")
+	l.Info("to file")
+	b, err := os.ReadFile(cfg.File)
+	c.Assert(err, gc.IsNil)
+	m := decode(c, b)
+	c.Assert(m[MessageKey], gc.Equals, "to file")
+	c.Assert(m["log.origin.file.name"], gc.Matches, "ecslog/ecslog_test.go:.*")
+}
+
+func (s *ECSSuite) TestTemplate(c *gc.C) {
+	b, err := Template{Patterns: []string{"logs-*"}, Pipeline: "ecs-logs"}.JSON()
+	c.Assert(err, gc.IsNil)
+	var t struct {
+		IndexPatterns []string `json:"index_patterns"`
+		Template      struct {
+			Settings struct {
+				Index map[string]interface{} `json:"index"`
+			} `json:"settings"`
+			Mappings struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"mappings"`
+		} `json:"template"`
+	}
+	c.Assert(json.Unmarshal(b, &t), gc.IsNil)
+	c.Assert(t.IndexPatterns, gc.DeepEquals, []string{"logs-*"})
+	c.Assert(t.Template.Settings.Index["default_pipeline"], gc.Equals, "ecs-logs")
+	c.Assert(t.Template.Settings.Index["number_of_replicas"], gc.Equals, 0.0)
+
+	var trace struct {
+		Properties map[string]map[string]interface{} `json:"properties"`
+	}
+	c.Assert(json.Unmarshal(t.Template.Mappings.Properties["trace"], &trace), gc.IsNil)
+	c.Assert(trace.Properties["id"]["type"], gc.Equals, "keyword")
+	c.Assert(string(t.Template.Mappings.Properties[TimestampKey]), gc.Matches, `{\s*"type": "date"\s*}`)
+
+	b, err = IngestPipeline()
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(b), gc.Matches, `(?s).*"dot_expander".*"field": "trace.id".*"event.ingested".*`)
+}
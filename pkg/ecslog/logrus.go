@@ -0,0 +1,69 @@
+package ecslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogrusFormatter пишет записи logrus в формате ECS.
+type LogrusFormatter struct {
+	// Service - значение service.name.
+	Service string
+}
+
+func (f LogrusFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	data := make(map[string]interface{}, len(e.Data)+6)
+	for k, v := range e.Data {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+			if k == logrus.ErrorKey {
+				data[ErrorTypeKey] = fmt.Sprintf("%T", err)
+			}
+		}
+		data[fieldName(k)] = v
+	}
+	data[TimestampKey] = e.Time.UTC().Format(time.RFC3339Nano)
+	data[LevelKey] = e.Level.String()
+	data[MessageKey] = e.Message
+	data[ServiceKey] = f.Service
+	data[VersionKey] = Version
+	if e.HasCaller() {
+		data["log.origin.function"] = e.Caller.Function
+		data["log.origin.file.name"] = fmt.Sprintf("%s:%d", e.Caller.File, e.Caller.Line)
+	}
+
+	b := e.Buffer
+	if b == nil {
+		b = &bytes.Buffer{}
+	}
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(data); err != nil {
+		return nil, fmt.Errorf("ecslog: marshal entry: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// SetupLogrus настраивает l по cfg: формат ECS (FormatConsole для logrus - текстовый
+// вывод), уровень и вывод с ротацией.
+func SetupLogrus(l *logrus.Logger, cfg Config, service string) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	level, err := logrus.ParseLevel(cfg.Level)
+	if err != nil {
+		return fmt.Errorf("log level: %w", err)
+	}
+	if cfg.Format == FormatConsole {
+		l.SetFormatter(&logrus.TextFormatter{})
+	} else {
+		l.SetFormatter(LogrusFormatter{Service: service})
+	}
+	l.SetLevel(level)
+	l.SetOutput(cfg.Writer())
+	return nil
+}
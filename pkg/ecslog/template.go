@@ -0,0 +1,131 @@
+package ecslog
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// FieldTypes - типы полей ECS в шаблоне индекса. Поля, которых здесь нет,
+// попадают под dynamic_templates: строки - keyword.
+var FieldTypes = map[string]string{
+	TimestampKey:                "date",
+	MessageKey:                  "text",
+	LevelKey:                    "keyword",
+	"log.logger":                "keyword",
+	"log.origin.file.name":      "keyword",
+	"log.origin.function":       "keyword",
+	ServiceKey:                  "keyword",
+	VersionKey:                  "keyword",
+	"trace.id":                  "keyword",
+	"span.id":                   "keyword",
+	"http.request.id":           "keyword",
+	"http.request.method":       "keyword",
+	"http.response.status_code": "long",
+	"url.path":                  "keyword",
+	"url.full":                  "keyword",
+	ErrorKey:                    "text",
+	ErrorTypeKey:                "keyword",
+	"error.stack_trace":         "text",
+	"event.duration":            "long",
+	"event.ingested":            "date",
+	"client.address":            "keyword",
+	"user_agent.original":       "keyword",
+}
+
+// Template - составной шаблон индекса для логов ECS (PUT _index_template/<имя>).
+type Template struct {
+	// Patterns - шаблоны имён индексов, например "logs-*".
+	Patterns []string
+	// Pipeline - ingest pipeline по умолчанию (index.default_pipeline), пусто - без него.
+	Pipeline string
+	// Replicas - число реплик; на кластере из одного узла - 0, иначе индекс "жёлтый".
+	Replicas int
+}
+
+// JSON - тело запроса для Elasticsearch.
+func (t Template) JSON() ([]byte, error) {
+	settings := map[string]interface{}{
+		"number_of_replicas": t.Replicas,
+	}
+	if t.Pipeline != "" {
+		settings["default_pipeline"] = t.Pipeline
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"index_patterns": t.Patterns,
+		"template": map[string]interface{}{
+			"settings": map[string]interface{}{"index": settings},
+			"mappings": map[string]interface{}{
+				"dynamic_templates": []interface{}{
+					map[string]interface{}{
+						"strings_as_keyword": map[string]interface{}{
+							"match_mapping_type": "string",
+							"mapping": map[string]interface{}{
+								"type":         "keyword",
+								"ignore_above": 1024,
+							},
+						},
+					},
+				},
+				"properties": properties(FieldTypes),
+			},
+		},
+		"_meta": map[string]interface{}{
+			"description": "ECS logs written by pkg/ecslog",
+			"ecs_version": Version,
+		},
+	}, "", "  ")
+}
+
+// properties раскладывает поля с точками в имени (trace.id) во вложенные объекты маппинга.
+func properties(types map[string]string) map[string]interface{} {
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	root := map[string]interface{}{}
+	for _, name := range names {
+		parts := strings.Split(name, ".")
+		props := root
+		for _, p := range parts[:len(parts)-1] {
+			obj, ok := props[p].(map[string]interface{})
+			if !ok {
+				obj = map[string]interface{}{"properties": map[string]interface{}{}}
+				props[p] = obj
+			}
+			props = obj["properties"].(map[string]interface{})
+		}
+		field := map[string]interface{}{"type": types[name]}
+		if types[name] == "keyword" {
+			field["ignore_above"] = 1024
+		}
+		props[parts[len(parts)-1]] = field
+	}
+	return root
+}
+
+// IngestPipeline - ingest pipeline для логов ECS (PUT _ingest/pipeline/<имя>): раскладывает
+// поля с точками в объекты, как в шаблоне, и проставляет event.ingested.
+func IngestPipeline() ([]byte, error) {
+	names := make([]string, 0, len(FieldTypes))
+	for name := range FieldTypes {
+		if strings.Contains(name, ".") && !strings.HasPrefix(name, "@") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	processors := make([]interface{}, 0, len(names)+1)
+	for _, name := range names {
+		processors = append(processors, map[string]interface{}{
+			"dot_expander": map[string]interface{}{"field": name, "ignore_failure": true},
+		})
+	}
+	processors = append(processors, map[string]interface{}{
+		"set": map[string]interface{}{"field": "event.ingested", "value": "{{_ingest.timestamp}}"},
+	})
+	return json.MarshalIndent(map[string]interface{}{
+		"description": "ECS logs written by pkg/ecslog",
+		"processors":  processors,
+	}, "", "  ")
+}
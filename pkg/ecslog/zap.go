@@ -0,0 +1,100 @@
+package ecslog
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// EncoderConfig - настройки JSON-энкодера zap для записей ECS.
+func EncoderConfig() zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
+		TimeKey:        TimestampKey,
+		LevelKey:       LevelKey,
+		NameKey:        "log.logger",
+		CallerKey:      "log.origin.file.name",
+		FunctionKey:    "log.origin.function",
+		MessageKey:     MessageKey,
+		StacktraceKey:  "error.stack_trace",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.NanosDurationEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+	}
+}
+
+// NewZapCore - core, который пишет записи ECS сервиса service в w.
+func NewZapCore(w zapcore.WriteSyncer, level zapcore.LevelEnabler, service string) zapcore.Core {
+	c := zapcore.NewCore(zapcore.NewJSONEncoder(EncoderConfig()), w, level)
+	return ecsCore{c.With([]zapcore.Field{
+		zap.String(ServiceKey, service),
+		zap.String(VersionKey, Version),
+	})}
+}
+
+// NewZap создаёт логгер сервиса service по cfg: записи ECS или, для разработки,
+// читаемый вывод zap.NewDevelopment.
+func NewZap(cfg Config, service string) (*zap.Logger, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	level, _ := cfg.level()
+	return NewZapLevel(cfg, service, level)
+}
+
+// NewZapLevel - NewZap с уровнем level вместо cfg.Level, например для loglevel.Levels.Wrap.
+func NewZapLevel(cfg Config, service string, level zapcore.LevelEnabler) (*zap.Logger, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	w := zapcore.AddSync(cfg.Writer())
+	if cfg.Format == FormatConsole {
+		enc := zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+		return zap.New(zapcore.NewCore(enc, w, level), zap.AddCaller(), zap.Development()), nil
+	}
+	return zap.New(NewZapCore(w, level, service), zap.AddCaller()), nil
+}
+
+// ecsCore переименовывает поля записей в поля ECS.
+type ecsCore struct {
+	zapcore.Core
+}
+
+func (c ecsCore) With(fields []zapcore.Field) zapcore.Core {
+	return ecsCore{c.Core.With(ecsFields(fields))}
+}
+
+func (c ecsCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c ecsCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(ent, ecsFields(fields))
+}
+
+// ecsFields - копия fields с именами ECS. zap.Error превращается в error.message
+// и error.type: энкодер zap пишет ошибку в поле с именем ключа и добавляет errorVerbose.
+func ecsFields(fields []zapcore.Field) []zapcore.Field {
+	ret := make([]zapcore.Field, 0, len(fields)+1)
+	for _, f := range fields {
+		if err, ok := f.Interface.(error); ok && f.Type == zapcore.ErrorType {
+			if f.Key != "error" {
+				ret = append(ret, zap.String(f.Key, err.Error()))
+				continue
+			}
+			ret = append(ret,
+				zap.String(ErrorKey, err.Error()),
+				zap.String(ErrorTypeKey, fmt.Sprintf("%T", err)),
+			)
+			continue
+		}
+		f.Key = fieldName(f.Key)
+		ret = append(ret, f)
+	}
+	return ret
+}
@@ -0,0 +1,203 @@
+// Package health - обработчики /healthz (liveness) и /readyz (readiness) с проверками зависимостей.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTimeout - таймаут проверки, если при добавлении он не задан.
+const DefaultTimeout = 2 * time.Second
+
+const (
+	StatusOK           = "ok"
+	StatusFail         = "fail"
+	StatusShuttingDown = "shutting_down"
+	// StatusDegraded - не прошла необязательная проверка, сервис обслуживает запросы.
+	StatusDegraded = "degraded"
+)
+
+// CheckFunc проверяет одну зависимость, nil - зависимость доступна.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name    string
+	timeout time.Duration
+	fn      CheckFunc
+	// optional - ошибка проверки не снимает сервис с трафика
+	optional bool
+}
+
+// Result - результат одной проверки.
+type Result struct {
+	Status     string  `json:"status"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Report - ответ /readyz.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Checker хранит проверки зависимостей и признак остановки сервиса.
+type Checker struct {
+	drainDelay time.Duration
+	draining   int32
+
+	mu     sync.RWMutex
+	checks []check
+}
+
+// New создаёт Checker. drainDelay - сколько Drain ждёт после перевода readiness в fail,
+// чтобы балансировщик успел снять сервис с трафика до остановки серверов.
+func New(drainDelay time.Duration) *Checker {
+	return &Checker{drainDelay: drainDelay}
+}
+
+// Add добавляет проверку, timeout <= 0 означает DefaultTimeout.
+func (c *Checker) Add(name string, timeout time.Duration, fn CheckFunc) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, timeout: timeout, fn: fn})
+}
+
+// AddOptional добавляет проверку зависимости, без которой сервис работает хуже, но работает:
+// её ошибка отмечается в ответе /readyz статусом degraded, но не даёт 503.
+func (c *Checker) AddOptional(name string, timeout time.Duration, fn CheckFunc) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, timeout: timeout, fn: fn, optional: true})
+}
+
+// Drain переводит readiness в fail и ждёт drainDelay или отмены ctx.
+// Подходит для lifecycle.Manager.OnShutdown.
+func (c *Checker) Drain(ctx context.Context) {
+	atomic.StoreInt32(&c.draining, 1)
+	if c.drainDelay <= 0 {
+		return
+	}
+	t := time.NewTimer(c.drainDelay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// Draining - true после вызова Drain.
+func (c *Checker) Draining() bool {
+	return atomic.LoadInt32(&c.draining) == 1
+}
+
+// Check выполняет все проверки параллельно, каждую со своим таймаутом. Если не прошли
+// только необязательные проверки, статус отчёта - StatusDegraded.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	rep := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	var (
+		wg               sync.WaitGroup
+		mu               sync.Mutex
+		failed, degraded bool
+	)
+	for _, ch := range checks {
+		wg.Add(1)
+		go func(ch check) {
+			defer wg.Done()
+			res := run(ctx, ch)
+			mu.Lock()
+			switch {
+			case res.Status == StatusOK:
+			case ch.optional:
+				res.Status = StatusDegraded
+				degraded = true
+			default:
+				failed = true
+			}
+			rep.Checks[ch.name] = res
+			mu.Unlock()
+		}(ch)
+	}
+	wg.Wait()
+	switch {
+	case failed:
+		rep.Status = StatusFail
+	case degraded:
+		rep.Status = StatusDegraded
+	}
+	if c.Draining() {
+		rep.Status = StatusShuttingDown
+	}
+	return rep
+}
+
+func run(ctx context.Context, ch check) Result {
+	ctx, cancel := context.WithTimeout(ctx, ch.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() { errc <- ch.fn(ctx) }()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		// проверка не уважает контекст - не ждём её
+		err = ctx.Err()
+	}
+	res := Result{
+		Status:     StatusOK,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = errors.New("timeout after " + ch.timeout.String())
+		}
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// LiveHandler - /healthz: процесс жив и обслуживает запросы, зависимости не проверяются.
+func (c *Checker) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Report{Status: StatusOK})
+	})
+}
+
+// ReadyHandler - /readyz: 200, если прошли все обязательные проверки и сервис не
+// останавливается, иначе 503.
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rep := c.Check(r.Context())
+		status := http.StatusOK
+		if rep.Status != StatusOK && rep.Status != StatusDegraded {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, rep)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
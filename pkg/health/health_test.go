@@ -0,0 +1,96 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(HealthSuite))
+
+type HealthSuite struct{}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func ready(c *gc.C, hc *Checker) (int, Report) {
+	rec := httptest.NewRecorder()
+	hc.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	c.Assert(rec.Header().Get("Content-Type"), gc.Equals, "application/json")
+	var rep Report
+	c.Assert(json.NewDecoder(rec.Body).Decode(&rep), gc.IsNil)
+	return rec.Code, rep
+}
+
+func (s *HealthSuite) TestReadyReportsEachCheck(c *gc.C) {
+	hc := New(0)
+	hc.Add("postgres", 0, func(ctx context.Context) error { return nil })
+	hc.Add("redis", 0, func(ctx context.Context) error { return errors.New("connection refused") })
+
+	code, rep := ready(c, hc)
+	c.Assert(code, gc.Equals, http.StatusServiceUnavailable)
+	c.Assert(rep.Status, gc.Equals, StatusFail)
+	c.Assert(rep.Checks["postgres"].Status, gc.Equals, StatusOK)
+	c.Assert(rep.Checks["redis"].Status, gc.Equals, StatusFail)
+	c.Assert(rep.Checks["redis"].Error, gc.Equals, "connection refused")
+}
+
+func (s *HealthSuite) TestOptionalCheckDegrades(c *gc.C) {
+	hc := New(0)
+	hc.Add("postgres", 0, func(ctx context.Context) error { return nil })
+	hc.AddOptional("cache", 0, func(ctx context.Context) error { return errors.New("circuit breaker open") })
+
+	code, rep := ready(c, hc)
+	c.Assert(code, gc.Equals, http.StatusOK)
+	c.Assert(rep.Status, gc.Equals, StatusDegraded)
+	c.Assert(rep.Checks["cache"].Status, gc.Equals, StatusDegraded)
+	c.Assert(rep.Checks["cache"].Error, gc.Equals, "circuit breaker open")
+
+	hc.Add("redis", 0, func(ctx context.Context) error { return errors.New("connection refused") })
+	code, rep = ready(c, hc)
+	c.Assert(code, gc.Equals, http.StatusServiceUnavailable)
+	c.Assert(rep.Status, gc.Equals, StatusFail)
+}
+
+func (s *HealthSuite) TestCheckTimeout(c *gc.C) {
+	hc := New(0)
+	block := make(chan struct{})
+	defer close(block)
+	hc.Add("stuck", 20*time.Millisecond, func(ctx context.Context) error {
+		<-block // игнорирует ctx
+		return nil
+	})
+
+	start := time.Now()
+	code, rep := ready(c, hc)
+	c.Assert(time.Since(start) < time.Second, gc.Equals, true)
+	c.Assert(code, gc.Equals, http.StatusServiceUnavailable)
+	c.Assert(rep.Checks["stuck"].Error, gc.Equals, "timeout after 20ms")
+}
+
+func (s *HealthSuite) TestDrainFailsReadinessOnly(c *gc.C) {
+	hc := New(time.Hour)
+	hc.Add("postgres", 0, func(ctx context.Context) error { return nil })
+
+	code, _ := ready(c, hc)
+	c.Assert(code, gc.Equals, http.StatusOK)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	hc.Drain(ctx) // возвращается по ctx, не дожидаясь drainDelay
+
+	code, rep := ready(c, hc)
+	c.Assert(code, gc.Equals, http.StatusServiceUnavailable)
+	c.Assert(rep.Status, gc.Equals, StatusShuttingDown)
+
+	rec := httptest.NewRecorder()
+	hc.LiveHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	c.Assert(rec.Code, gc.Equals, http.StatusOK)
+}
@@ -0,0 +1,91 @@
+// Package httpmetrics - RED-метрики (rate, errors, duration) для HTTP-роутеров.
+package httpmetrics
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	LabelRoute  = "route"
+	LabelMethod = "method"
+	LabelStatus = "status"
+
+	// unmatchedRoute - метка для запросов, не попавших ни в один маршрут.
+	// Сырой путь в метку не пишем: иначе любой сканер раздует кардинальность.
+	unmatchedRoute = "unmatched"
+)
+
+// Metrics - счётчик запросов, гистограмма длительности и число запросов в обработке.
+type Metrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+}
+
+// New создаёт метрики и регистрирует их в reg.
+func New(reg prometheus.Registerer, namespace string) (*Metrics, error) {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "The number of handled HTTP requests",
+		}, []string{LabelRoute, LabelMethod, LabelStatus}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "The distribution of HTTP request latencies",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{LabelRoute, LabelMethod, LabelStatus}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_in_flight",
+			Help:      "The number of HTTP requests being handled",
+		}, []string{LabelRoute, LabelMethod}),
+	}
+	for _, c := range []prometheus.Collector{m.requests, m.duration, m.inFlight} {
+		if err := reg.Register(c); err != nil {
+			return nil, fmt.Errorf("register http metrics: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// Gin - middleware для gin. Маршрут берётся из шаблона (/read/:id), а не из пути запроса.
+// Подключается до recovery: если паника пройдёт через middleware, запрос попадёт в метрики
+// с кодом, выставленным до паники (обычно 200), а не с 500.
+func (m *Metrics) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := c.Request.Method
+
+		inFlight := m.inFlight.WithLabelValues(route, method)
+		inFlight.Inc()
+		start := time.Now()
+		defer func() {
+			inFlight.Dec()
+			status := StatusClass(c.Writer.Status())
+			m.requests.WithLabelValues(route, method, status).Inc()
+			m.duration.WithLabelValues(route, method, status).Observe(time.Since(start).Seconds())
+		}()
+
+		c.Next()
+	}
+}
+
+// StatusClass сворачивает код ответа в класс: 200 -> "2xx", 404 -> "4xx".
+func StatusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%dxx", code/100)
+}
@@ -0,0 +1,72 @@
+package httpmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(GinSuite))
+
+type GinSuite struct {
+	reg *prometheus.Registry
+	m   *Metrics
+	r   *gin.Engine
+}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *GinSuite) SetUpTest(c *gc.C) {
+	gin.SetMode(gin.TestMode)
+	s.reg = prometheus.NewRegistry()
+	m, err := New(s.reg, "test")
+	c.Assert(err, gc.IsNil)
+	s.m = m
+
+	s.r = gin.New()
+	s.r.Use(m.Gin(), gin.Recovery())
+	s.r.GET("/read/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	s.r.GET("/fail", func(c *gin.Context) { c.Status(http.StatusServiceUnavailable) })
+	s.r.GET("/panic", func(c *gin.Context) { panic("boom") })
+}
+
+func (s *GinSuite) do(method, path string) {
+	s.r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+}
+
+func (s *GinSuite) TestLabelsUseRouteTemplate(c *gc.C) {
+	s.do(http.MethodGet, "/read/1")
+	s.do(http.MethodGet, "/read/2")
+	s.do(http.MethodGet, "/fail")
+	s.do(http.MethodGet, "/no/such/route")
+
+	c.Assert(testutil.ToFloat64(s.m.requests.WithLabelValues("/read/:id", "GET", "2xx")), gc.Equals, 2.0)
+	c.Assert(testutil.ToFloat64(s.m.requests.WithLabelValues("/fail", "GET", "5xx")), gc.Equals, 1.0)
+	c.Assert(testutil.ToFloat64(s.m.requests.WithLabelValues(unmatchedRoute, "GET", "4xx")), gc.Equals, 1.0)
+	c.Assert(testutil.CollectAndCount(s.m.duration), gc.Equals, 3)
+	c.Assert(testutil.ToFloat64(s.m.inFlight.WithLabelValues("/read/:id", "GET")), gc.Equals, 0.0)
+}
+
+func (s *GinSuite) TestPanicCountedAs5xx(c *gc.C) {
+	s.do(http.MethodGet, "/panic")
+	c.Assert(testutil.ToFloat64(s.m.requests.WithLabelValues("/panic", "GET", "5xx")), gc.Equals, 1.0)
+	c.Assert(testutil.ToFloat64(s.m.requests.WithLabelValues("/panic", "GET", "2xx")), gc.Equals, 0.0)
+}
+
+func (s *GinSuite) TestDoubleRegistrationFails(c *gc.C) {
+	_, err := New(s.reg, "test")
+	c.Assert(err, gc.NotNil)
+}
+
+func (s *GinSuite) TestStatusClass(c *gc.C) {
+	c.Assert(StatusClass(204), gc.Equals, "2xx")
+	c.Assert(StatusClass(302), gc.Equals, "3xx")
+	c.Assert(StatusClass(0), gc.Equals, "unknown")
+}
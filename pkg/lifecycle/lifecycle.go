@@ -0,0 +1,145 @@
+// Package lifecycle - запуск нескольких HTTP-серверов одного сервиса и их согласованная остановка.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const DefaultShutdownTimeout = 10 * time.Second
+
+type server struct {
+	name string
+	srv  *http.Server
+	ln   net.Listener
+}
+
+// Manager запускает серверы одновременно и останавливает их все вместе:
+// по отмене контекста (например, по SIGTERM) или когда любой из серверов упал.
+type Manager struct {
+	shutdownTimeout time.Duration
+
+	mu         sync.Mutex
+	servers    []*server
+	onShutdown []func(ctx context.Context)
+}
+
+func New(shutdownTimeout time.Duration) *Manager {
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = DefaultShutdownTimeout
+	}
+	return &Manager{shutdownTimeout: shutdownTimeout}
+}
+
+// Add регистрирует сервер, name используется в ошибках.
+func (m *Manager) Add(name string, srv *http.Server) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.servers = append(m.servers, &server{name: name, srv: srv})
+}
+
+// OnShutdown добавляет функцию, которая вызывается перед остановкой серверов.
+// Функции вызываются по порядку добавления с контекстом, ограниченным таймаутом остановки.
+func (m *Manager) OnShutdown(f func(ctx context.Context)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onShutdown = append(m.onShutdown, f)
+}
+
+// Addr возвращает фактический адрес сервера после запуска (полезно при порте 0).
+func (m *Manager) Addr(name string) net.Addr {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.servers {
+		if s.name == name && s.ln != nil {
+			return s.ln.Addr()
+		}
+	}
+	return nil
+}
+
+// Run открывает все адреса, обслуживает запросы и блокируется до остановки.
+// Если какой-то адрес занять не удалось, уже открытые закрываются и возвращается ошибка.
+// Возвращает nil при штатной остановке по ctx и первую ошибку сервера иначе.
+func (m *Manager) Run(ctx context.Context) error {
+	m.mu.Lock()
+	servers := m.servers
+	for i, s := range servers {
+		ln, err := net.Listen("tcp", s.srv.Addr)
+		if err != nil {
+			for _, opened := range servers[:i] {
+				_ = opened.ln.Close()
+				opened.ln = nil
+			}
+			m.mu.Unlock()
+			return fmt.Errorf("%s server: listen %s: %w", s.name, s.srv.Addr, err)
+		}
+		s.ln = ln
+	}
+	m.mu.Unlock()
+
+	errc := make(chan error, len(servers))
+	for _, s := range servers {
+		go func(s *server) {
+			if err := s.srv.Serve(s.ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errc <- fmt.Errorf("%s server: %w", s.name, err)
+				return
+			}
+			errc <- nil
+		}(s)
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case runErr = <-errc:
+		// один сервер завершился сам - останавливаем остальные
+		if runErr == nil {
+			runErr = errors.New("server stopped unexpectedly")
+		}
+	}
+
+	shutdownErr := m.shutdown(servers)
+	if runErr != nil {
+		return runErr
+	}
+	return shutdownErr
+}
+
+func (m *Manager) shutdown(servers []*server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.shutdownTimeout)
+	defer cancel()
+
+	m.mu.Lock()
+	hooks := m.onShutdown
+	m.mu.Unlock()
+	for _, f := range hooks {
+		f(ctx)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s *server) {
+			defer wg.Done()
+			if err := s.srv.Shutdown(ctx); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s server: shutdown: %w", s.name, err)
+				}
+				mu.Unlock()
+			}
+		}(s)
+	}
+	wg.Wait()
+	return firstErr
+}
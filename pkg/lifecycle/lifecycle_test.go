@@ -0,0 +1,77 @@
+package lifecycle
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(ManagerSuite))
+
+type ManagerSuite struct{}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func (s *ManagerSuite) TestServesUntilContextCancelled(c *gc.C) {
+	m := New(time.Second)
+	m.Add("api", &http.Server{Addr: "127.0.0.1:0", Handler: okHandler()})
+	m.Add("admin", &http.Server{Addr: "127.0.0.1:0", Handler: okHandler()})
+	hooked := make(chan struct{})
+	m.OnShutdown(func(ctx context.Context) { close(hooked) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- m.Run(ctx) }()
+
+	for _, name := range []string{"api", "admin"} {
+		var addr net.Addr
+		for i := 0; i < 100 && addr == nil; i++ {
+			addr = m.Addr(name)
+			time.Sleep(5 * time.Millisecond)
+		}
+		c.Assert(addr, gc.NotNil, gc.Commentf(name))
+		resp, err := http.Get("http://" + addr.String())
+		c.Assert(err, gc.IsNil)
+		resp.Body.Close()
+		c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		c.Assert(err, gc.IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("Run did not return after cancel")
+	}
+	select {
+	case <-hooked:
+	default:
+		c.Fatal("shutdown hook was not called")
+	}
+}
+
+func (s *ManagerSuite) TestBindErrorIsReturned(c *gc.C) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, gc.IsNil)
+	defer busy.Close()
+
+	m := New(time.Second)
+	m.Add("api", &http.Server{Addr: "127.0.0.1:0", Handler: okHandler()})
+	m.Add("admin", &http.Server{Addr: busy.Addr().String(), Handler: okHandler()})
+
+	err = m.Run(context.Background())
+	c.Assert(err, gc.ErrorMatches, "admin server: listen .*")
+	c.Assert(m.Addr("api"), gc.IsNil, gc.Commentf("already opened listeners must be closed"))
+}
@@ -0,0 +1,60 @@
+// Package logctx связывает логи с трейсами: в каждую запись добавляются trace_id,
+// span_id и request_id из контекста, а записи уровня error и выше дублируются
+// событием "log" в текущем спане. Поддерживаются zap и logrus:
+//
+//	logctx.Zap(ctx, logger).Error("failed to get users", zap.Error(err))
+//
+//	log.AddHook(logctx.LogrusHook{})
+//	log.WithContext(ctx).WithError(err).Error("create link failed")
+package logctx
+
+import (
+	"context"
+
+	"github.com/Deny7676yar/observability/pkg/requestid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Имена полей в записях лога.
+const (
+	TraceIDKey   = "trace_id"
+	SpanIDKey    = "span_id"
+	RequestIDKey = "request_id"
+	// PanicKey - значение перехваченной паники (pkg/recovery). В Sentry такие записи
+	// не отправляются: панику со стеком туда отправляет sentryreport.Middleware.
+	PanicKey = "panic"
+)
+
+// EventName - имя события спана, в которое копируется запись лога.
+const EventName = "log"
+
+// Атрибуты события EventName.
+const (
+	SeverityKey = attribute.Key("log.severity")
+	MessageKey  = attribute.Key("log.message")
+)
+
+// Fields - поля корреляции из ctx; пустые значения не попадают в результат.
+func Fields(ctx context.Context) map[string]string {
+	ret := make(map[string]string, 3)
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		ret[TraceIDKey] = sc.TraceID().String()
+		ret[SpanIDKey] = sc.SpanID().String()
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		ret[RequestIDKey] = id
+	}
+	return ret
+}
+
+// addEvent копирует запись лога в спан, если он записывается.
+func addEvent(span trace.Span, severity, msg string, attrs []attribute.KeyValue) {
+	if !span.IsRecording() {
+		return
+	}
+	span.AddEvent(EventName, trace.WithAttributes(append([]attribute.KeyValue{
+		SeverityKey.String(severity),
+		MessageKey.String(msg),
+	}, attrs...)...))
+}
@@ -0,0 +1,117 @@
+package logctx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Deny7676yar/observability/pkg/requestid"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(LogSuite))
+
+type LogSuite struct {
+	sr  *tracetest.SpanRecorder
+	tp  *sdktrace.TracerProvider
+	ctx context.Context
+}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *LogSuite) SetUpTest(c *gc.C) {
+	s.sr = tracetest.NewSpanRecorder()
+	s.tp = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(s.sr))
+	s.ctx = requestid.NewContext(context.Background(), "req-1")
+}
+
+func eventAttrs(c *gc.C, span sdktrace.ReadOnlySpan) []map[string]string {
+	var ret []map[string]string
+	for _, e := range span.Events() {
+		c.Assert(e.Name, gc.Equals, EventName)
+		m := map[string]string{}
+		for _, kv := range e.Attributes {
+			m[string(kv.Key)] = kv.Value.AsString()
+		}
+		ret = append(ret, m)
+	}
+	return ret
+}
+
+func (s *LogSuite) TestZap(c *gc.C) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	ctx, span := s.tp.Tracer("test").Start(s.ctx, "handler")
+
+	l := Zap(ctx, zap.New(core)).With(zap.String("user", "42"))
+	l.Info("user loaded")
+	l.Error("failed to get articles", zap.Error(errors.New("timeout")))
+	span.End()
+
+	c.Assert(logs.Len(), gc.Equals, 2)
+	for _, e := range logs.All() {
+		f := e.ContextMap()
+		c.Assert(f[TraceIDKey], gc.Equals, span.SpanContext().TraceID().String())
+		c.Assert(f[SpanIDKey], gc.Equals, span.SpanContext().SpanID().String())
+		c.Assert(f[RequestIDKey], gc.Equals, "req-1")
+	}
+	c.Assert(eventAttrs(c, s.sr.Ended()[0]), gc.DeepEquals, []map[string]string{{
+		string(SeverityKey): "error",
+		string(MessageKey):  "failed to get articles",
+		"error":             "timeout",
+		"user":              "42",
+		RequestIDKey:        "req-1",
+	}})
+}
+
+func (s *LogSuite) TestZapKeepsCoreLevel(c *gc.C) {
+	core, logs := observer.New(zapcore.DPanicLevel)
+	ctx, span := s.tp.Tracer("test").Start(s.ctx, "handler")
+
+	l := Zap(ctx, zap.New(core))
+	l.Info("user loaded")
+	l.Error("failed to get articles")
+	span.End()
+
+	c.Assert(logs.Len(), gc.Equals, 0, gc.Commentf("the wrapped core filters both records"))
+	c.Assert(eventAttrs(c, s.sr.Ended()[0]), gc.HasLen, 1, gc.Commentf("errors still reach the span"))
+}
+
+func (s *LogSuite) TestZapWithoutSpan(c *gc.C) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	Zap(s.ctx, zap.New(core)).Error("no trace")
+	Zap(context.Background(), zap.New(core)).Info("nothing to add")
+
+	c.Assert(logs.All()[0].ContextMap(), gc.DeepEquals, map[string]interface{}{RequestIDKey: "req-1"})
+	c.Assert(logs.All()[1].ContextMap(), gc.HasLen, 0)
+}
+
+func (s *LogSuite) TestLogrusHook(c *gc.C) {
+	l, hook := logrustest.NewNullLogger()
+	l.AddHook(LogrusHook{})
+	ctx, span := s.tp.Tracer("test").Start(s.ctx, "handler")
+
+	l.WithContext(ctx).Warn("slow request")
+	l.WithContext(ctx).WithError(errors.New("duplicate key")).Error("create link failed")
+	l.Error("no context")
+	span.End()
+
+	c.Assert(hook.Entries, gc.HasLen, 3)
+	c.Assert(hook.Entries[0].Data[TraceIDKey], gc.Equals, span.SpanContext().TraceID().String())
+	c.Assert(hook.Entries[0].Data[SpanIDKey], gc.Equals, span.SpanContext().SpanID().String())
+	c.Assert(hook.Entries[0].Data[RequestIDKey], gc.Equals, "req-1")
+	c.Assert(hook.Entries[2].Data, gc.HasLen, 0)
+	c.Assert(eventAttrs(c, s.sr.Ended()[0]), gc.DeepEquals, []map[string]string{{
+		string(SeverityKey): "error",
+		string(MessageKey):  "create link failed",
+		"error":             "duplicate key",
+		RequestIDKey:        "req-1",
+	}})
+}
@@ -0,0 +1,44 @@
+package logctx
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// LogrusHook добавляет поля корреляции в записи с контекстом (log.WithContext(ctx))
+// и копирует записи уровня error и выше в события спана.
+type LogrusHook struct{}
+
+func (LogrusHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (LogrusHook) Fire(e *logrus.Entry) error {
+	if e.Context == nil {
+		return nil
+	}
+	for k, v := range Fields(e.Context) {
+		if _, ok := e.Data[k]; !ok {
+			e.Data[k] = v
+		}
+	}
+	if e.Level > logrus.ErrorLevel {
+		return nil
+	}
+	attrs := make([]attribute.KeyValue, 0, len(e.Data))
+	for k, v := range e.Data {
+		switch k {
+		case TraceIDKey, SpanIDKey:
+			continue
+		}
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		attrs = append(attrs, attribute.String(k, fmt.Sprint(v)))
+	}
+	addEvent(trace.SpanFromContext(e.Context), e.Level.String(), e.Message, attrs)
+	return nil
+}
@@ -0,0 +1,94 @@
+package logctx
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Zap возвращает l с полями корреляции из ctx. Записи уровня error и выше
+// дополнительно пишутся событием в спан из ctx.
+func Zap(ctx context.Context, l *zap.Logger) *zap.Logger {
+	f := Fields(ctx)
+	if len(f) == 0 {
+		return l
+	}
+	fields := make([]zap.Field, 0, len(f))
+	for _, k := range []string{TraceIDKey, SpanIDKey, RequestIDKey} {
+		if v, ok := f[k]; ok {
+			fields = append(fields, zap.String(k, v))
+		}
+	}
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return l.With(fields...)
+	}
+	return l.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return &spanCore{Core: c, span: span}
+	})).With(fields...)
+}
+
+// spanCore копирует записи уровня error и выше в события спана.
+type spanCore struct {
+	zapcore.Core
+	span trace.Span
+	// fields - поля из With, кроме полей корреляции: они в спане уже есть
+	fields []zapcore.Field
+}
+
+func (c *spanCore) With(fields []zapcore.Field) zapcore.Core {
+	own := make([]zapcore.Field, len(c.fields), len(c.fields)+len(fields))
+	copy(own, c.fields)
+	for _, f := range fields {
+		switch f.Key {
+		case TraceIDKey, SpanIDKey:
+		default:
+			own = append(own, f)
+		}
+	}
+	return &spanCore{Core: c.Core.With(fields), span: c.span, fields: own}
+}
+
+// Enabled: записи уровня error и выше нужны спану, даже если обёрнутое ядро их не пишет.
+func (c *spanCore) Enabled(l zapcore.Level) bool {
+	return l >= zapcore.ErrorLevel || c.Core.Enabled(l)
+}
+
+// Check оставляет решение о записи в лог обёрнутому ядру: фильтры уровней и ядра,
+// пишущие только ошибки, продолжают работать. Записи уровня error и выше попадают
+// в спан, даже если в лог они не пишутся.
+func (c *spanCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level >= zapcore.ErrorLevel {
+		ce = ce.AddCore(ent, spanEventCore{c})
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// spanEventCore пишет запись только событием в спан, в обёрнутое ядро - нет.
+type spanEventCore struct {
+	*spanCore
+}
+
+func (c spanEventCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	attrs := make([]attribute.KeyValue, 0, len(enc.Fields))
+	for k, v := range enc.Fields {
+		attrs = append(attrs, attribute.String(k, fmt.Sprint(v)))
+	}
+	addEvent(c.span, ent.Level.String(), ent.Message, attrs)
+	return nil
+}
+
+func (c spanEventCore) Sync() error {
+	return nil
+}
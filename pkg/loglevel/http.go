@@ -0,0 +1,76 @@
+package loglevel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// request - тело PUT: {"level": "debug", "component": "cache", "ttl": "10m"}.
+// Без component меняется общий уровень, без ttl - постоянно.
+type request struct {
+	Level     string `json:"level"`
+	Component string `json:"component"`
+	TTL       string `json:"ttl"`
+}
+
+// Handler - ручка уровней логов:
+//
+//	GET                        - текущие уровни (State)
+//	PUT {"level", "component", "ttl"} - изменить уровень
+//	DELETE ?component=cache    - вернуть компоненту общий уровень
+//
+// Ручка административная: подключается рядом с /debug/pprof, не на публичный порт.
+func (lv *Levels) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			err = lv.put(r)
+		case http.MethodDelete:
+			err = lv.Reset(r.Context(), r.URL.Query().Get("component"))
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		switch {
+		case errors.Is(err, ErrUnknownComponent):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		case err != nil:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		default:
+			writeJSON(w, http.StatusOK, lv.State())
+		}
+	})
+}
+
+func (lv *Levels) put(r *http.Request) error {
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return fmt.Errorf("bad request body: %w", err)
+	}
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(req.Level)); err != nil {
+		return fmt.Errorf("level: %w", err)
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+			return fmt.Errorf("ttl must be a positive duration, got %q", req.TTL)
+		}
+	}
+	return lv.Set(r.Context(), req.Component, l, ttl)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,282 @@
+// Package loglevel - уровень логов, который меняется во время работы сервиса: общий
+// и для отдельных компонентов (именованных логгеров zap: "cache", "pgx"). Изменение
+// может быть временным - через TTL уровень возвращается к прежнему. Каждое изменение
+// пишется в лог (аудит). Handler - HTTP-ручка для чтения и изменения уровней.
+//
+//	levels, err := loglevel.New(cfg.Log.Level)
+//	logger, err := ecslog.NewZapLevel(cfg.Log, ServiceName, zapcore.DebugLevel)
+//	logger = levels.Wrap(logger)
+//	cacheLogger := levels.Named(logger, "cache")
+package loglevel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Global - имя общего уровня в Change и State.
+const Global = ""
+
+// Причины изменения уровня в Change.
+const (
+	ReasonSet     = "set"
+	ReasonReset   = "reset"
+	ReasonExpired = "expired"
+)
+
+// ErrUnknownComponent - компонент не зарегистрирован через Named.
+var ErrUnknownComponent = errors.New("unknown component")
+
+// Change - изменение уровня, передаётся в аудит.
+type Change struct {
+	// Component - компонент или Global.
+	Component string
+	// From и To - уровни до и после. Для компонента без своего уровня - общий уровень.
+	From, To zapcore.Level
+	// TTL - через сколько изменение отменится, 0 - постоянное.
+	TTL    time.Duration
+	Reason string
+}
+
+// auditFunc записывает изменение; ctx - контекст запроса к Handler (для ReasonExpired - фоновый).
+type auditFunc func(ctx context.Context, ch Change)
+
+// setting - уровень компонента или общий. revert - что вернуть по истечении TTL.
+type setting struct {
+	level   zapcore.Level
+	set     bool
+	expires time.Time
+	revert  *setting
+	timer   *time.Timer
+}
+
+// snapshot - неизменяемая копия уровней для проверки записей без блокировок.
+type snapshot struct {
+	global     zapcore.Level
+	components map[string]zapcore.Level
+	min        zapcore.Level
+}
+
+// Levels - общий уровень и уровни компонентов.
+type Levels struct {
+	mu         sync.Mutex
+	global     setting
+	components map[string]*setting
+	audit      []auditFunc
+	onGlobal   []func(zapcore.Level)
+	snap       atomic.Value
+}
+
+// New создаёт уровни с общим уровнем initial ("debug", "info", ...).
+func New(initial string) (*Levels, error) {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(initial)); err != nil {
+		return nil, fmt.Errorf("log level: %w", err)
+	}
+	lv := &Levels{
+		global:     setting{level: l, set: true},
+		components: map[string]*setting{},
+	}
+	lv.publish()
+	return lv, nil
+}
+
+func (lv *Levels) load() *snapshot {
+	return lv.snap.Load().(*snapshot)
+}
+
+// publish обновляет snapshot, вызывается под mu.
+func (lv *Levels) publish() {
+	s := &snapshot{
+		global:     lv.global.level,
+		components: make(map[string]zapcore.Level, len(lv.components)),
+		min:        lv.global.level,
+	}
+	for name, c := range lv.components {
+		if !c.set {
+			continue
+		}
+		s.components[name] = c.level
+		if c.level < s.min {
+			s.min = c.level
+		}
+	}
+	lv.snap.Store(s)
+}
+
+// Enabled - включён ли уровень l для компонента component (Global - общий уровень).
+func (lv *Levels) Enabled(component string, l zapcore.Level) bool {
+	s := lv.load()
+	if level, ok := s.components[component]; ok {
+		return l >= level
+	}
+	return l >= s.global
+}
+
+// register добавляет компонент, чтобы его уровень можно было менять.
+func (lv *Levels) register(component string) {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+	if _, ok := lv.components[component]; !ok {
+		lv.components[component] = &setting{}
+	}
+}
+
+// target - настройка компонента или общая, вызывается под mu.
+func (lv *Levels) target(component string) (*setting, error) {
+	if component == Global {
+		return &lv.global, nil
+	}
+	c, ok := lv.components[component]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownComponent, component)
+	}
+	return c, nil
+}
+
+// effective - действующий уровень настройки s, вызывается под mu.
+func (lv *Levels) effective(s *setting) zapcore.Level {
+	if s.set {
+		return s.level
+	}
+	return lv.global.level
+}
+
+// Set меняет уровень компонента (Global - общий). ttl > 0 - временно: по истечении
+// возвращается уровень, действовавший до первого из подряд идущих временных изменений.
+func (lv *Levels) Set(ctx context.Context, component string, l zapcore.Level, ttl time.Duration) error {
+	lv.mu.Lock()
+	s, err := lv.target(component)
+	if err != nil {
+		lv.mu.Unlock()
+		return err
+	}
+	ch := Change{Component: component, From: lv.effective(s), To: l, TTL: ttl, Reason: ReasonSet}
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	revert := s.revert
+	if ttl > 0 && revert == nil {
+		revert = &setting{level: s.level, set: s.set}
+	}
+	if ttl <= 0 {
+		revert = nil
+	}
+	*s = setting{level: l, set: true, revert: revert}
+	if ttl > 0 {
+		s.expires = time.Now().Add(ttl)
+		s.timer = time.AfterFunc(ttl, func() { lv.expire(component, s) })
+	}
+	lv.changed(ctx, ch)
+	return nil
+}
+
+// Reset убирает уровень компонента: снова действует общий. Для Global не применяется.
+func (lv *Levels) Reset(ctx context.Context, component string) error {
+	if component == Global {
+		return errors.New("global level can not be reset")
+	}
+	lv.mu.Lock()
+	s, err := lv.target(component)
+	if err != nil {
+		lv.mu.Unlock()
+		return err
+	}
+	ch := Change{Component: component, From: lv.effective(s), To: lv.global.level, Reason: ReasonReset}
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	*s = setting{}
+	lv.changed(ctx, ch)
+	return nil
+}
+
+// expire возвращает уровень по истечении TTL, если s не поменяли снова.
+func (lv *Levels) expire(component string, s *setting) {
+	lv.mu.Lock()
+	if s.revert == nil || time.Now().Before(s.expires) {
+		lv.mu.Unlock()
+		return
+	}
+	from := lv.effective(s)
+	*s = *s.revert
+	lv.changed(context.Background(), Change{Component: component, From: from, To: lv.effective(s), Reason: ReasonExpired})
+}
+
+// changed публикует уровни, снимает mu и сообщает об изменении подписчикам и в аудит.
+func (lv *Levels) changed(ctx context.Context, ch Change) {
+	lv.publish()
+	global := lv.global.level
+	onGlobal := lv.onGlobal
+	audit := lv.audit
+	lv.mu.Unlock()
+	if ch.Component == Global {
+		for _, f := range onGlobal {
+			f(global)
+		}
+	}
+	for _, f := range audit {
+		f(ctx, ch)
+	}
+}
+
+// ComponentState - уровень компонента в State.
+type ComponentState struct {
+	// Level - собственный уровень компонента, пусто - действует общий.
+	Level     string     `json:"level,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// State - текущие уровни, ответ Handler.
+type State struct {
+	Global          string                    `json:"global"`
+	GlobalExpiresAt *time.Time                `json:"global_expires_at,omitempty"`
+	Components      map[string]ComponentState `json:"components"`
+}
+
+// State - текущие уровни.
+func (lv *Levels) State() State {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+	st := State{
+		Global:          lv.global.level.String(),
+		GlobalExpiresAt: expiresAt(&lv.global),
+		Components:      make(map[string]ComponentState, len(lv.components)),
+	}
+	for name, c := range lv.components {
+		cs := ComponentState{ExpiresAt: expiresAt(c)}
+		if c.set {
+			cs.Level = c.level.String()
+		}
+		st.Components[name] = cs
+	}
+	return st
+}
+
+// Components - зарегистрированные компоненты по алфавиту.
+func (lv *Levels) Components() []string {
+	lv.mu.Lock()
+	defer lv.mu.Unlock()
+	ret := make([]string, 0, len(lv.components))
+	for name := range lv.components {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func expiresAt(s *setting) *time.Time {
+	if s.timer == nil {
+		return nil
+	}
+	t := s.expires.UTC()
+	return &t
+}
@@ -0,0 +1,170 @@
+package loglevel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(LevelsSuite))
+
+type LevelsSuite struct {
+	lv     *Levels
+	logs   *observer.ObservedLogs
+	logger *zap.Logger
+	cache  *zap.Logger
+}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *LevelsSuite) SetUpTest(c *gc.C) {
+	var err error
+	s.lv, err = New("info")
+	c.Assert(err, gc.IsNil)
+	core, logs := observer.New(zapcore.DebugLevel)
+	s.logs = logs
+	s.logger = s.lv.Wrap(zap.New(core))
+	s.cache = s.lv.Named(s.logger, "cache")
+	s.lv.Named(s.logger, "pgx")
+}
+
+// messages - сообщения записей, кроме аудита, и очистка наблюдателя.
+func (s *LevelsSuite) messages() []string {
+	var ret []string
+	for _, e := range s.logs.TakeAll() {
+		if e.LoggerName != AuditComponent {
+			ret = append(ret, e.Message)
+		}
+	}
+	return ret
+}
+
+func (s *LevelsSuite) TestGlobalAndComponent(c *gc.C) {
+	ctx := context.Background()
+	s.logger.Debug("global debug")
+	s.cache.Debug("cache debug")
+	s.logger.Info("global info")
+	c.Assert(s.messages(), gc.DeepEquals, []string{"global info"})
+
+	c.Assert(s.lv.Set(ctx, "cache", zapcore.DebugLevel, 0), gc.IsNil)
+	s.logger.Debug("global debug")
+	s.cache.Named("redis").Debug("cache debug")
+	c.Assert(s.messages(), gc.DeepEquals, []string{"cache debug"})
+
+	c.Assert(s.lv.Set(ctx, Global, zapcore.ErrorLevel, 0), gc.IsNil)
+	s.logger.Warn("global warn")
+	s.cache.Debug("cache still debug")
+	c.Assert(s.messages(), gc.DeepEquals, []string{"cache still debug"})
+
+	c.Assert(s.lv.Reset(ctx, "cache"), gc.IsNil)
+	s.cache.Warn("cache warn")
+	c.Assert(s.messages(), gc.HasLen, 0)
+
+	c.Assert(s.lv.Set(ctx, "nope", zapcore.DebugLevel, 0), gc.ErrorMatches, `unknown component "nope"`)
+	c.Assert(s.lv.Reset(ctx, Global), gc.NotNil)
+}
+
+func (s *LevelsSuite) TestAudit(c *gc.C) {
+	c.Assert(s.lv.Set(context.Background(), Global, zapcore.ErrorLevel, time.Minute), gc.IsNil)
+	entries := s.logs.Filter(func(e observer.LoggedEntry) bool {
+		return e.LoggerName == AuditComponent
+	}).All()
+	c.Assert(entries, gc.HasLen, 1, gc.Commentf("audit is written whatever the level"))
+	c.Assert(entries[0].Message, gc.Equals, "log level changed")
+	c.Assert(entries[0].ContextMap(), gc.DeepEquals, map[string]interface{}{
+		"component": "global",
+		"from":      "info",
+		"to":        "error",
+		"reason":    ReasonSet,
+		"ttl":       time.Minute,
+	})
+}
+
+func (s *LevelsSuite) TestTTL(c *gc.C) {
+	ctx := context.Background()
+	c.Assert(s.lv.Set(ctx, "cache", zapcore.WarnLevel, 0), gc.IsNil)
+	c.Assert(s.lv.Set(ctx, "cache", zapcore.DebugLevel, 50*time.Millisecond), gc.IsNil)
+	// повторное временное изменение продлевает его, но возвращает исходный уровень
+	c.Assert(s.lv.Set(ctx, "cache", zapcore.InfoLevel, 100*time.Millisecond), gc.IsNil)
+	st := s.lv.State()
+	c.Assert(st.Components["cache"].Level, gc.Equals, "info")
+	c.Assert(st.Components["cache"].ExpiresAt, gc.NotNil)
+	c.Assert(st.Components["pgx"], gc.DeepEquals, ComponentState{})
+
+	// аудит пишется после смены уровня, ждём его
+	deadline := time.Now().Add(2 * time.Second)
+	for s.logs.FilterField(zap.String("reason", ReasonExpired)).Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	expired := s.logs.FilterField(zap.String("reason", ReasonExpired)).All()
+	c.Assert(expired, gc.HasLen, 1)
+	st = s.lv.State()
+	c.Assert(st.Components["cache"].Level, gc.Equals, "warn")
+	c.Assert(st.Components["cache"].ExpiresAt, gc.IsNil)
+	c.Assert(expired[0].ContextMap()["to"], gc.Equals, "warn")
+}
+
+func (s *LevelsSuite) TestHandler(c *gc.C) {
+	h := s.lv.Handler()
+	do := func(method, target, body string) (int, State) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		var st State
+		_ = json.Unmarshal(rec.Body.Bytes(), &st)
+		return rec.Code, st
+	}
+
+	code, st := do(http.MethodGet, "/", "")
+	c.Assert(code, gc.Equals, http.StatusOK)
+	c.Assert(st.Global, gc.Equals, "info")
+	c.Assert(st.Components, gc.HasLen, 2)
+
+	code, st = do(http.MethodPut, "/", `{"level":"debug","component":"pgx","ttl":"1m"}`)
+	c.Assert(code, gc.Equals, http.StatusOK)
+	c.Assert(st.Components["pgx"].Level, gc.Equals, "debug")
+	c.Assert(st.Components["pgx"].ExpiresAt, gc.NotNil)
+
+	code, st = do(http.MethodDelete, "/?component=pgx", "")
+	c.Assert(code, gc.Equals, http.StatusOK)
+	c.Assert(st.Components["pgx"].Level, gc.Equals, "")
+
+	code, _ = do(http.MethodPut, "/", `{"level":"loud"}`)
+	c.Assert(code, gc.Equals, http.StatusBadRequest)
+	code, _ = do(http.MethodPut, "/", `{"level":"debug","ttl":"-1s"}`)
+	c.Assert(code, gc.Equals, http.StatusBadRequest)
+	code, _ = do(http.MethodPut, "/", `{"level":"debug","component":"nope"}`)
+	c.Assert(code, gc.Equals, http.StatusNotFound)
+	code, _ = do(http.MethodPost, "/", "")
+	c.Assert(code, gc.Equals, http.StatusMethodNotAllowed)
+}
+
+func (s *LevelsSuite) TestLogrus(c *gc.C) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetFormatter(&logrus.JSONFormatter{})
+	s.lv.Logrus(l)
+	c.Assert(l.GetLevel(), gc.Equals, logrus.InfoLevel)
+
+	c.Assert(s.lv.Set(context.Background(), Global, zapcore.ErrorLevel, 0), gc.IsNil)
+	c.Assert(l.GetLevel(), gc.Equals, logrus.ErrorLevel)
+	l.Warn("dropped")
+
+	var audit map[string]interface{}
+	c.Assert(json.Unmarshal(buf.Bytes(), &audit), gc.IsNil, gc.Commentf("%s", buf.String()))
+	c.Assert(audit["msg"], gc.Equals, "log level changed")
+	c.Assert(audit["to"], gc.Equals, "error")
+}
@@ -0,0 +1,67 @@
+package loglevel
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/zap/zapcore"
+)
+
+// Logrus связывает общий уровень с уровнем l и пишет аудит в l. Компонентов у logrus нет.
+func (lv *Levels) Logrus(l *logrus.Logger) {
+	lv.mu.Lock()
+	l.SetLevel(logrusLevel(lv.global.level))
+	lv.onGlobal = append(lv.onGlobal, func(level zapcore.Level) {
+		l.SetLevel(logrusLevel(level))
+	})
+	lv.audit = append(lv.audit, func(ctx context.Context, ch Change) {
+		auditLogrus(ctx, l, ch)
+	})
+	lv.mu.Unlock()
+}
+
+func logrusLevel(l zapcore.Level) logrus.Level {
+	switch l {
+	case zapcore.DebugLevel:
+		return logrus.DebugLevel
+	case zapcore.InfoLevel:
+		return logrus.InfoLevel
+	case zapcore.WarnLevel:
+		return logrus.WarnLevel
+	case zapcore.ErrorLevel:
+		return logrus.ErrorLevel
+	case zapcore.FatalLevel:
+		return logrus.FatalLevel
+	default:
+		// DPanic и Panic
+		return logrus.PanicLevel
+	}
+}
+
+// auditLogrus пишет запись аудита в обход уровня l: иначе при уровне error
+// изменение уровня не попало бы в лог. Хуки для неё не вызываются.
+func auditLogrus(ctx context.Context, l *logrus.Logger, ch Change) {
+	component := ch.Component
+	if component == Global {
+		component = "global"
+	}
+	e := l.WithContext(ctx).WithFields(logrus.Fields{
+		"logger":    AuditComponent,
+		"component": component,
+		"from":      ch.From.String(),
+		"to":        ch.To.String(),
+		"reason":    ch.Reason,
+	})
+	if ch.TTL > 0 {
+		e = e.WithField("ttl", ch.TTL.String())
+	}
+	e.Time = time.Now()
+	e.Level = logrus.InfoLevel
+	e.Message = "log level changed"
+	b, err := l.Formatter.Format(e)
+	if err != nil {
+		return
+	}
+	_, _ = l.Out.Write(b)
+}
@@ -0,0 +1,78 @@
+package loglevel
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Deny7676yar/observability/pkg/logctx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// AuditComponent - имя логгера записей аудита. Они пишутся при любом уровне: аудит
+// идёт в логгер до фильтра уровней.
+const AuditComponent = "loglevel"
+
+// Wrap возвращает l, записи которого фильтруются по уровням lv: компонент записи -
+// первая часть имени логгера (cache для cache.redis). Ядро l должно пропускать все
+// уровни (ecslog.NewZapLevel с zapcore.DebugLevel), иначе уровень ниже начального
+// не включить. Изменения уровней пишутся в l с именем AuditComponent.
+func (lv *Levels) Wrap(l *zap.Logger) *zap.Logger {
+	audit := l.Named(AuditComponent)
+	lv.mu.Lock()
+	lv.audit = append(lv.audit, func(ctx context.Context, ch Change) {
+		logctx.Zap(ctx, audit).Info("log level changed", zapFields(ch)...)
+	})
+	lv.mu.Unlock()
+	return l.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return &levelCore{Core: c, lv: lv}
+	}))
+}
+
+// Named - l.Named(component), уровень которого можно менять отдельно.
+func (lv *Levels) Named(l *zap.Logger, component string) *zap.Logger {
+	lv.register(component)
+	return l.Named(component)
+}
+
+func zapFields(ch Change) []zap.Field {
+	component := ch.Component
+	if component == Global {
+		component = "global"
+	}
+	fields := []zap.Field{
+		zap.String("component", component),
+		zap.Stringer("from", ch.From),
+		zap.Stringer("to", ch.To),
+		zap.String("reason", ch.Reason),
+	}
+	if ch.TTL > 0 {
+		fields = append(fields, zap.Duration("ttl", ch.TTL))
+	}
+	return fields
+}
+
+// levelCore пропускает записи по уровню их компонента.
+type levelCore struct {
+	zapcore.Core
+	lv *Levels
+}
+
+func (c *levelCore) Enabled(l zapcore.Level) bool {
+	return l >= c.lv.load().min
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), lv: c.lv}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	component := ent.LoggerName
+	if i := strings.IndexByte(component, '.'); i >= 0 {
+		component = component[:i]
+	}
+	if !c.lv.Enabled(component, ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
@@ -0,0 +1,56 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Run выполняет команду миграций up, down или status и пишет отчёт в w.
+// Нужна, чтобы все бинарники предлагали одинаковые подкоманды.
+func Run(ctx context.Context, m *Migrator, cmd string, w io.Writer) error {
+	switch cmd {
+	case "up":
+		done, err := m.Up(ctx)
+		for _, mg := range done {
+			fmt.Fprintf(w, "applied %d_%s\n", mg.Version, mg.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Fprintln(w, "no pending migrations")
+		}
+		return nil
+	case "down":
+		mg, err := m.Down(ctx)
+		if err != nil {
+			return err
+		}
+		if mg == nil {
+			fmt.Fprintln(w, "no applied migrations")
+			return nil
+		}
+		fmt.Fprintf(w, "reverted %d_%s\n", mg.Version, mg.Name)
+		return nil
+	case "status":
+		st, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range st {
+			at := "pending"
+			if s.Applied {
+				at = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, at)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("%w %q, want up, down or status", ErrUnknownCommand, cmd)
+	}
+}
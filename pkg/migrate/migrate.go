@@ -0,0 +1,261 @@
+// Package migrate - версионные миграции схемы Postgres из набора SQL-файлов.
+//
+// Файлы миграций называются <version>_<name>.up.sql и <version>_<name>.down.sql
+// и обычно встраиваются в бинарник через embed.FS. Применённые версии хранятся
+// в отдельной таблице, а сама миграция выполняется под advisory lock, поэтому
+// несколько одновременно стартующих реплик не мешают друг другу.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const DefaultTable = "schema_migrations"
+
+var (
+	ErrNoDownMigration = errors.New("no down migration")
+	ErrUnknownCommand  = errors.New("unknown migrate command")
+)
+
+var fileRe = regexp.MustCompile(`^(\d+)_([A-Za-z0-9_\-]+)\.(up|down)\.sql$`)
+
+// Migration - одна версия схемы.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status - состояние миграции в конкретной базе.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Load читает миграции из корня fsys и возвращает их по возрастанию версии.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations dir: %w", err)
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+		m := fileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("bad migration file name %q, want <version>_<name>.(up|down).sql", e.Name())
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad migration version in %q: %w", e.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("read migration %q: %w", e.Name(), err)
+		}
+
+		mg, ok := byVersion[version]
+		if !ok {
+			mg = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mg
+		}
+		if mg.Name != m[2] {
+			return nil, fmt.Errorf("migration version %d has two names: %q and %q", version, mg.Name, m[2])
+		}
+		if m[3] == "up" {
+			mg.Up = string(body)
+		} else {
+			mg.Down = string(body)
+		}
+	}
+
+	ret := make([]Migration, 0, len(byVersion))
+	for _, mg := range byVersion {
+		if mg.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", mg.Version, mg.Name)
+		}
+		ret = append(ret, *mg)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Version < ret[j].Version })
+	return ret, nil
+}
+
+// Migrator применяет и откатывает миграции в одной базе.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	table      string
+	lockKey    int64
+}
+
+// New создаёт Migrator для миграций из fsys, версии хранятся в таблице table (DefaultTable, если пусто).
+func New(db *sql.DB, fsys fs.FS, table string) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if table == "" {
+		table = DefaultTable
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("migrate:" + table))
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+		table:      table,
+		lockKey:    int64(h.Sum64()),
+	}, nil
+}
+
+// Up применяет все ещё не применённые миграции и возвращает их.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mg := range m.migrations {
+			if _, ok := applied[mg.Version]; ok {
+				continue
+			}
+			err := m.inTx(ctx, conn, mg.Up,
+				`INSERT INTO `+m.table+` (version, name, applied_at) VALUES ($1, $2, $3)`,
+				mg.Version, mg.Name, time.Now())
+			if err != nil {
+				return fmt.Errorf("apply migration %d_%s: %w", mg.Version, mg.Name, err)
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down откатывает последнюю применённую миграцию. Если откатывать нечего, возвращает nil.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	var done *Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mg := m.migrations[i]
+			if _, ok := applied[mg.Version]; !ok {
+				continue
+			}
+			if mg.Down == "" {
+				return fmt.Errorf("%w for %d_%s", ErrNoDownMigration, mg.Version, mg.Name)
+			}
+			err := m.inTx(ctx, conn, mg.Down,
+				`DELETE FROM `+m.table+` WHERE version = $1`, mg.Version)
+			if err != nil {
+				return fmt.Errorf("revert migration %d_%s: %w", mg.Version, mg.Name, err)
+			}
+			done = &mg
+			return nil
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status возвращает все известные миграции с отметкой о применении.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var ret []Status
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mg := range m.migrations {
+			at, ok := applied[mg.Version]
+			ret = append(ret, Status{Migration: mg, Applied: ok, AppliedAt: at})
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// locked выполняет f на выделенном соединении под pg_advisory_lock.
+// Блокировка сессионная, поэтому все запросы внутри идут через одно соединение.
+func (m *Migrator) locked(ctx context.Context, f func(conn *sql.Conn) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, m.lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// Контекст мог уже истечь, а снять блокировку нужно в любом случае.
+		if _, uerr := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, m.lockKey); uerr != nil && err == nil {
+			err = fmt.Errorf("release migration lock: %w", uerr)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+m.table+` (
+		version bigint NOT NULL PRIMARY KEY,
+		name varchar NOT NULL,
+		applied_at timestamptz NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("create %s table: %w", m.table, err)
+	}
+	return f(conn)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM `+m.table)
+	if err != nil {
+		return nil, fmt.Errorf("read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	ret := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			v  int64
+			at time.Time
+		)
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		ret[v] = at
+	}
+	return ret, rows.Err()
+}
+
+// inTx выполняет тело миграции и запись в таблицу версий одной транзакцией.
+func (m *Migrator) inTx(ctx context.Context, conn *sql.Conn, body, bookkeeping string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,171 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+	gc "gopkg.in/check.v1"
+)
+
+var (
+	_ = gc.Suite(new(LoadSuite))
+	_ = gc.Suite(new(PgSuite))
+)
+
+type LoadSuite struct{}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *LoadSuite) TestLoadOrdersByVersion(c *gc.C) {
+	ms, err := Load(fstest.MapFS{
+		"0010_add_index.up.sql":    {Data: []byte("CREATE INDEX")},
+		"0002_create_links.up.sql": {Data: []byte("CREATE TABLE")},
+		"0002_create_links.down.sql": {
+			Data: []byte("DROP TABLE"),
+		},
+		"README.md": {Data: []byte("not a migration")},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(ms, gc.DeepEquals, []Migration{
+		{Version: 2, Name: "create_links", Up: "CREATE TABLE", Down: "DROP TABLE"},
+		{Version: 10, Name: "add_index", Up: "CREATE INDEX"},
+	})
+}
+
+func (s *LoadSuite) TestLoadRejectsBadSets(c *gc.C) {
+	for name, fsys := range map[string]fstest.MapFS{
+		"bad name":    {"create_links.up.sql": {Data: []byte("x")}},
+		"no up file":  {"0001_create_links.down.sql": {Data: []byte("x")}},
+		"name clash":  {"0001_a.up.sql": {Data: []byte("x")}, "0001_b.up.sql": {Data: []byte("y")}},
+		"bad version": {"99999999999999999999_a.up.sql": {Data: []byte("x")}},
+	} {
+		_, err := Load(fsys)
+		c.Assert(err, gc.NotNil, gc.Commentf(name))
+	}
+}
+
+// PgSuite проверяет Migrator на живой базе из PG_DSN.
+type PgSuite struct {
+	db *sql.DB
+}
+
+const testTable = "migrate_test_versions"
+
+// testMigrations - первая миграция спит, чтобы одновременные Up пересеклись без блокировки.
+var testMigrations = fstest.MapFS{
+	"0001_items.up.sql":     {Data: []byte("SELECT pg_sleep(0.2); CREATE TABLE migrate_test_items (id int PRIMARY KEY)")},
+	"0001_items.down.sql":   {Data: []byte("DROP TABLE migrate_test_items")},
+	"0002_item_name.up.sql": {Data: []byte("ALTER TABLE migrate_test_items ADD COLUMN name text")},
+	"0002_item_name.down.sql": {
+		Data: []byte("ALTER TABLE migrate_test_items DROP COLUMN name"),
+	},
+}
+
+func (s *PgSuite) SetUpSuite(c *gc.C) {
+	dsn := os.Getenv("PG_DSN")
+	if dsn == "" {
+		c.Skip("Missing PG_DSN envvar; skipping postgresdb-backed test suite")
+	}
+	db, err := sql.Open("pgx", dsn)
+	c.Assert(err, gc.IsNil)
+	s.db = db
+}
+
+func (s *PgSuite) SetUpTest(c *gc.C) {
+	s.flushDB(c)
+}
+
+func (s *PgSuite) TearDownSuite(c *gc.C) {
+	if s.db != nil {
+		s.flushDB(c)
+		c.Assert(s.db.Close(), gc.IsNil)
+	}
+}
+
+func (s *PgSuite) flushDB(c *gc.C) {
+	_, err := s.db.Exec("DROP TABLE IF EXISTS migrate_test_items, " + testTable)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *PgSuite) migrator(c *gc.C) *Migrator {
+	m, err := New(s.db, testMigrations, testTable)
+	c.Assert(err, gc.IsNil)
+	return m
+}
+
+func versions(ms []Migration) []int64 {
+	ret := make([]int64, 0, len(ms))
+	for _, m := range ms {
+		ret = append(ret, m.Version)
+	}
+	return ret
+}
+
+// hasName - есть ли колонка name, которую добавляет вторая миграция.
+func (s *PgSuite) hasName(c *gc.C) bool {
+	var n int
+	err := s.db.QueryRow(`SELECT count(*) FROM information_schema.columns
+	WHERE table_name = 'migrate_test_items' AND column_name = 'name'`).Scan(&n)
+	c.Assert(err, gc.IsNil)
+	return n == 1
+}
+
+func (s *PgSuite) TestUpDownUp(c *gc.C) {
+	ctx := context.Background()
+	m := s.migrator(c)
+
+	done, err := m.Up(ctx)
+	c.Assert(err, gc.IsNil)
+	c.Assert(versions(done), gc.DeepEquals, []int64{1, 2})
+	c.Assert(s.hasName(c), gc.Equals, true)
+	done, err = m.Up(ctx)
+	c.Assert(err, gc.IsNil)
+	c.Assert(done, gc.HasLen, 0, gc.Commentf("applied migrations must not run twice"))
+
+	reverted, err := m.Down(ctx)
+	c.Assert(err, gc.IsNil)
+	c.Assert(reverted.Version, gc.Equals, int64(2))
+	c.Assert(s.hasName(c), gc.Equals, false)
+	st, err := m.Status(ctx)
+	c.Assert(err, gc.IsNil)
+	c.Assert(st, gc.HasLen, 2)
+	c.Assert(st[0].Applied, gc.Equals, true)
+	c.Assert(st[0].AppliedAt.IsZero(), gc.Equals, false)
+	c.Assert(st[1].Applied, gc.Equals, false)
+
+	done, err = m.Up(ctx)
+	c.Assert(err, gc.IsNil)
+	c.Assert(versions(done), gc.DeepEquals, []int64{2})
+	c.Assert(s.hasName(c), gc.Equals, true)
+
+	var n int
+	c.Assert(s.db.QueryRow(`SELECT count(*) FROM `+testTable).Scan(&n), gc.IsNil)
+	c.Assert(n, gc.Equals, 2)
+}
+
+func (s *PgSuite) TestConcurrentUp(c *gc.C) {
+	ctx := context.Background()
+	ms := []*Migrator{s.migrator(c), s.migrator(c)}
+	done := make([][]Migration, len(ms))
+	errs := make([]error, len(ms))
+	var wg sync.WaitGroup
+	for i, m := range ms {
+		wg.Add(1)
+		go func(i int, m *Migrator) {
+			defer wg.Done()
+			done[i], errs[i] = m.Up(ctx)
+		}(i, m)
+	}
+	wg.Wait()
+
+	c.Assert(errs, gc.DeepEquals, []error{nil, nil})
+	c.Assert(len(done[0])+len(done[1]), gc.Equals, 2, gc.Commentf("each migration is applied by exactly one migrator"))
+	c.Assert(s.hasName(c), gc.Equals, true)
+}
@@ -0,0 +1,118 @@
+// Package pgxtrace - спаны OpenTelemetry для запросов pgx v4.
+//
+// pgx v4 не даёт хуков вокруг запроса, но пишет в ConnConfig.Logger запись о каждом
+// выполненном запросе вместе с длительностью. Logger строит по этой записи спан
+// задним числом: начало - время записи минус длительность, родитель - спан из контекста запроса.
+//
+//	config.ConnConfig.Logger = pgxtrace.NewLogger(tp, zapadapter.NewLogger(logger))
+//	config.ConnConfig.LogLevel = pgx.LogLevelInfo // успешные запросы пишутся с уровнем Info
+//
+// В db.statement пишется запрос после Normalize. Аргументы запросов пишутся в db.args
+// только с опцией WithArgs, значения выбранных колонок при этом скрываются.
+// Транзакции и батчи получают общий спан через Logger.BeginFunc и Logger.SendBatch.
+package pgxtrace
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/Deny7676yar/observability/pkg/pgxtrace"
+
+const (
+	// RowCountKey - число прочитанных строк для Query.
+	RowCountKey = attribute.Key("db.row_count")
+	// ArgsKey - аргументы запроса, пишутся только с WithArgs.
+	ArgsKey = attribute.Key("db.args")
+)
+
+// queryMessages - сообщения pgx о выполненных запросах, остальные записи (подключение и т.п.) не трейсятся.
+var queryMessages = map[string]bool{
+	"Query":             true,
+	"Exec":              true,
+	"CopyFrom":          true,
+	"BatchResult.Exec":  true,
+	"BatchResult.Query": true,
+	"BatchResult.Close": true,
+}
+
+// Logger - pgx.Logger, который создаёт спан на каждый запрос и передаёт запись дальше в next.
+type Logger struct {
+	tracer trace.Tracer
+	next   pgx.Logger
+	args   bool
+	redact RedactFunc
+}
+
+// Option - настройка Logger.
+type Option func(*Logger)
+
+// WithArgs включает запись аргументов запросов в db.args. Аргументы, для которых
+// redact вернула true, заменяются на Redacted; redact может быть nil.
+func WithArgs(redact RedactFunc) Option {
+	return func(l *Logger) {
+		l.args = true
+		l.redact = redact
+	}
+}
+
+// NewLogger - next может быть nil, тогда записи только превращаются в спаны.
+func NewLogger(tp trace.TracerProvider, next pgx.Logger, opts ...Option) *Logger {
+	l := &Logger{
+		tracer: tp.Tracer(instrumentationName),
+		next:   next,
+	}
+	for _, o := range opts {
+		o(l)
+	}
+	return l
+}
+
+func (l *Logger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	if l.next != nil {
+		l.next.Log(ctx, level, msg, data)
+	}
+	if !queryMessages[msg] || !trace.SpanContextFromContext(ctx).IsValid() {
+		// запросы вне трейса (миграции при старте, фоновые задачи) не создают корневых спанов
+		return
+	}
+
+	end := time.Now()
+	start := end
+	// в записи об ошибке длительности нет, такой спан получается нулевой длины
+	if d, ok := data["time"].(time.Duration); ok {
+		start = end.Add(-d)
+	}
+
+	attrs := []attribute.KeyValue{semconv.DBSystemPostgreSQL}
+	if sql, ok := data["sql"].(string); ok {
+		attrs = append(attrs,
+			semconv.DBStatementKey.String(Normalize(sql)),
+			semconv.DBOperationKey.String(operation(sql)))
+		if args, ok := data["args"].([]interface{}); ok && l.args && len(args) > 0 {
+			attrs = append(attrs, ArgsKey.StringSlice(formatArgs(sql, args, l.redact)))
+		}
+	}
+	if table, ok := data["tableName"].(pgx.Identifier); ok {
+		attrs = append(attrs, semconv.DBSQLTableKey.String(table.Sanitize()))
+	}
+	if n, ok := data["rowCount"].(int); ok {
+		attrs = append(attrs, RowCountKey.Int(n))
+	}
+	_, span := l.tracer.Start(ctx, "pgx "+msg,
+		trace.WithTimestamp(start),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	if err, ok := data["err"].(error); ok {
+		span.RecordError(err, trace.WithTimestamp(end))
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(end))
+}
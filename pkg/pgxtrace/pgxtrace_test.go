@@ -0,0 +1,270 @@
+package pgxtrace
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(LoggerSuite))
+
+type LoggerSuite struct {
+	sr *tracetest.SpanRecorder
+	tp *sdktrace.TracerProvider
+}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+type countLogger struct{ n int }
+
+func (l *countLogger) Log(context.Context, pgx.LogLevel, string, map[string]interface{}) { l.n++ }
+
+func (s *LoggerSuite) SetUpTest(c *gc.C) {
+	s.sr = tracetest.NewSpanRecorder()
+	s.tp = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(s.sr))
+}
+
+func (s *LoggerSuite) TestQueryBecomesChildSpan(c *gc.C) {
+	next := &countLogger{}
+	l := NewLogger(s.tp, next)
+	ctx, parent := s.tp.Tracer("test").Start(context.Background(), "handler")
+
+	l.Log(ctx, pgx.LogLevelInfo, "Query", map[string]interface{}{
+		"sql":      "SELECT id FROM users WHERE name = $1",
+		"time":     150 * time.Millisecond,
+		"rowCount": 3,
+	})
+	l.Log(ctx, pgx.LogLevelInfo, "Dialing PostgreSQL server", map[string]interface{}{"host": "localhost"})
+	parent.End()
+
+	c.Assert(next.n, gc.Equals, 2, gc.Commentf("every record must reach the next logger"))
+	ended := s.sr.Ended()
+	c.Assert(ended, gc.HasLen, 2)
+	q := ended[0]
+	c.Assert(q.Name(), gc.Equals, "pgx Query")
+	c.Assert(q.Parent().SpanID(), gc.Equals, parent.SpanContext().SpanID())
+	c.Assert(q.EndTime().Sub(q.StartTime()), gc.Equals, 150*time.Millisecond)
+	attrs := make(map[string]string)
+	for _, kv := range q.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	c.Assert(attrs[string(semconv.DBStatementKey)], gc.Equals, "SELECT id FROM users WHERE name = $1")
+	c.Assert(attrs[string(RowCountKey)], gc.Equals, "3")
+}
+
+func (s *LoggerSuite) TestErrorMarksSpan(c *gc.C) {
+	l := NewLogger(s.tp, nil)
+	ctx, parent := s.tp.Tracer("test").Start(context.Background(), "handler")
+	l.Log(ctx, pgx.LogLevelError, "Exec", map[string]interface{}{
+		"sql": "INSERT INTO users(name) VALUES($1)",
+		"err": errors.New("duplicate key"),
+	})
+	parent.End()
+
+	q := s.sr.Ended()[0]
+	c.Assert(q.Status().Code, gc.Equals, codes.Error)
+	c.Assert(q.Status().Description, gc.Equals, "duplicate key")
+}
+
+func (s *LoggerSuite) TestNoSpanWithoutParent(c *gc.C) {
+	l := NewLogger(s.tp, nil)
+	l.Log(context.Background(), pgx.LogLevelInfo, "Exec", map[string]interface{}{"sql": "SELECT 1", "time": time.Millisecond})
+	c.Assert(s.sr.Ended(), gc.HasLen, 0)
+}
+
+func attrsOf(s sdktrace.ReadOnlySpan) map[string]string {
+	ret := make(map[string]string)
+	for _, kv := range s.Attributes() {
+		ret[string(kv.Key)] = kv.Value.Emit()
+	}
+	return ret
+}
+
+func (s *LoggerSuite) TestNormalize(c *gc.C) {
+	c.Assert(Normalize("SELECT id, title FROM articles WHERE user_id\n= $1"), gc.Equals,
+		"SELECT id, title FROM articles WHERE user_id = $1")
+	c.Assert(Normalize("  SELECT * FROM t2 WHERE name = 'O''Brien' AND age > 42 LIMIT 10.5 "), gc.Equals,
+		"SELECT * FROM t2 WHERE name = ? AND age > ? LIMIT ?")
+}
+
+func (s *LoggerSuite) TestArgsAreCapturedAndRedacted(c *gc.C) {
+	redact := RedactColumns("name", "email")
+	c.Assert(redact("UPDATE users SET u.name=$2 WHERE id = $1", 1, nil), gc.Equals, true)
+	c.Assert(redact("UPDATE users SET u.name=$2 WHERE id = $1", 0, nil), gc.Equals, false)
+	c.Assert(redact(`SELECT id FROM users WHERE "email" ILIKE $1`, 0, nil), gc.Equals, true)
+	c.Assert(redact("INSERT INTO users (id, name) VALUES ($1, $2)", 1, nil), gc.Equals, true)
+	c.Assert(redact("INSERT INTO users (id, name) VALUES ($1, $2)", 0, nil), gc.Equals, false)
+
+	ctx, parent := s.tp.Tracer("test").Start(context.Background(), "handler")
+	data := map[string]interface{}{
+		"sql":  "SELECT id FROM users WHERE id = $1 AND name = $2",
+		"args": []interface{}{7, "alice"},
+		"time": time.Millisecond,
+	}
+	NewLogger(s.tp, nil).Log(ctx, pgx.LogLevelInfo, "Query", data)
+	NewLogger(s.tp, nil, WithArgs(redact)).Log(ctx, pgx.LogLevelInfo, "Query", data)
+	parent.End()
+
+	ended := s.sr.Ended()
+	_, captured := attrsOf(ended[0])[string(ArgsKey)]
+	c.Assert(captured, gc.Equals, false, gc.Commentf("args are off by default"))
+	c.Assert(ended[1].Attributes(), gc.Not(gc.HasLen), 0)
+	for _, kv := range ended[1].Attributes() {
+		if kv.Key == ArgsKey {
+			c.Assert(kv.Value.AsStringSlice(), gc.DeepEquals, []string{"7", Redacted})
+		}
+	}
+	c.Assert(attrsOf(ended[1])[string(semconv.DBOperationKey)], gc.Equals, "SELECT")
+}
+
+type fakeTx struct {
+	pgx.Tx
+	committed, rolledBack bool
+	rollbackErr           error
+}
+
+func (t *fakeTx) Commit(context.Context) error {
+	t.committed = true
+	return nil
+}
+
+func (t *fakeTx) Rollback(context.Context) error {
+	if t.committed {
+		return pgx.ErrTxClosed
+	}
+	t.rolledBack = true
+	return t.rollbackErr
+}
+
+type fakeDB struct {
+	tx      *fakeTx
+	results *fakeResults
+	ctx     context.Context
+}
+
+func (db *fakeDB) BeginTx(ctx context.Context, _ pgx.TxOptions) (pgx.Tx, error) {
+	db.ctx = ctx
+	return db.tx, nil
+}
+
+func (db *fakeDB) SendBatch(ctx context.Context, _ *pgx.Batch) pgx.BatchResults {
+	db.ctx = ctx
+	return db.results
+}
+
+type fakeResults struct {
+	pgx.BatchResults
+	closeErr error
+	queryErr error
+	rowErr   error
+}
+
+func (r *fakeResults) Close() error { return r.closeErr }
+
+func (r *fakeResults) Query() (pgx.Rows, error) { return nil, r.queryErr }
+
+func (r *fakeResults) QueryRow() pgx.Row { return fakeRow{r.rowErr} }
+
+type fakeRow struct {
+	err error
+}
+
+func (r fakeRow) Scan(...interface{}) error { return r.err }
+
+func (s *LoggerSuite) TestTransactionSpan(c *gc.C) {
+	l := NewLogger(s.tp, nil)
+	db := &fakeDB{tx: &fakeTx{}}
+	err := l.BeginFunc(context.Background(), db, pgx.TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+		l.Log(ctx, pgx.LogLevelInfo, "Exec", map[string]interface{}{"sql": "DELETE FROM users", "time": time.Millisecond})
+		return nil
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(db.tx.committed, gc.Equals, true)
+
+	ended := s.sr.Ended()
+	c.Assert(ended, gc.HasLen, 2)
+	c.Assert(ended[1].Name(), gc.Equals, "pgx transaction")
+	c.Assert(ended[0].Parent().SpanID(), gc.Equals, ended[1].SpanContext().SpanID())
+	c.Assert(attrsOf(ended[1])[string(TxOutcomeKey)], gc.Equals, "commit")
+
+	db.tx = &fakeTx{}
+	err = l.BeginFunc(context.Background(), db, pgx.TxOptions{}, func(context.Context, pgx.Tx) error {
+		return errors.New("constraint violated")
+	})
+	c.Assert(err, gc.ErrorMatches, "constraint violated")
+	c.Assert(db.tx.rolledBack, gc.Equals, true)
+	tx := s.sr.Ended()[2]
+	c.Assert(tx.Status().Code, gc.Equals, codes.Error)
+	c.Assert(attrsOf(tx)[string(TxOutcomeKey)], gc.Equals, "rollback")
+
+	db.tx = &fakeTx{rollbackErr: errors.New("conn lost")}
+	err = l.BeginFunc(context.Background(), db, pgx.TxOptions{}, func(context.Context, pgx.Tx) error {
+		return errors.New("constraint violated")
+	})
+	c.Assert(err, gc.ErrorMatches, "constraint violated", gc.Commentf("rollback error must not hide the cause"))
+	tx = s.sr.Ended()[3]
+	c.Assert(tx.Status().Description, gc.Equals, "constraint violated")
+	var recorded []string
+	for _, e := range tx.Events() {
+		for _, kv := range e.Attributes {
+			if kv.Key == semconv.ExceptionMessageKey {
+				recorded = append(recorded, kv.Value.AsString())
+			}
+		}
+	}
+	c.Assert(recorded, gc.DeepEquals, []string{"rollback: conn lost", "constraint violated"})
+}
+
+func (s *LoggerSuite) TestBatchSpanEndsOnClose(c *gc.C) {
+	l := NewLogger(s.tp, nil)
+	db := &fakeDB{results: &fakeResults{closeErr: errors.New("conn closed")}}
+	b := &pgx.Batch{}
+	b.Queue("SELECT 1")
+	b.Queue("SELECT 2")
+
+	br := l.SendBatch(context.Background(), db, b)
+	c.Assert(s.sr.Ended(), gc.HasLen, 0)
+	c.Assert(db.ctx, gc.NotNil)
+	c.Assert(br.Close(), gc.ErrorMatches, "conn closed")
+
+	ended := s.sr.Ended()
+	c.Assert(ended, gc.HasLen, 1)
+	c.Assert(ended[0].Name(), gc.Equals, "pgx batch")
+	c.Assert(attrsOf(ended[0])[string(BatchSizeKey)], gc.Equals, "2")
+	c.Assert(ended[0].Status().Code, gc.Equals, codes.Error)
+}
+
+func (s *LoggerSuite) TestBatchQueryErrorsMarkSpan(c *gc.C) {
+	l := NewLogger(s.tp, nil)
+	b := &pgx.Batch{}
+	b.Queue("SELECT 1")
+
+	db := &fakeDB{results: &fakeResults{rowErr: pgx.ErrNoRows}}
+	br := l.SendBatch(context.Background(), db, b)
+	c.Assert(br.QueryRow().Scan(), gc.Equals, pgx.ErrNoRows)
+	c.Assert(br.Close(), gc.IsNil)
+	c.Assert(s.sr.Ended()[0].Status().Code, gc.Equals, codes.Unset, gc.Commentf("no rows is not a batch error"))
+
+	db.results = &fakeResults{rowErr: errors.New("division by zero")}
+	br = l.SendBatch(context.Background(), db, b)
+	c.Assert(br.QueryRow().Scan(), gc.ErrorMatches, "division by zero")
+	c.Assert(br.Close(), gc.ErrorMatches, "division by zero")
+	c.Assert(s.sr.Ended()[1].Status().Description, gc.Equals, "division by zero")
+
+	db.results = &fakeResults{queryErr: errors.New("syntax error")}
+	br = l.SendBatch(context.Background(), db, b)
+	_, err := br.Query()
+	c.Assert(err, gc.ErrorMatches, "syntax error")
+	c.Assert(br.Close(), gc.ErrorMatches, "syntax error")
+	c.Assert(s.sr.Ended()[2].Status().Description, gc.Equals, "syntax error")
+}
@@ -0,0 +1,139 @@
+package pgxtrace
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Normalize приводит запрос к виду для db.statement: пробелы и переводы строк схлопываются,
+// строковые и числовые литералы заменяются на ?, плейсхолдеры $N остаются.
+// Так одинаковые запросы с разными литералами группируются, а значения не попадают в трейсы.
+func Normalize(sql string) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+	rs := []rune(strings.TrimSpace(sql))
+	space := false
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case r == '\'':
+			// '...' с экранированием ''
+			for i++; i < len(rs); i++ {
+				if rs[i] == '\'' {
+					if i+1 < len(rs) && rs[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			r = '?'
+		case unicode.IsDigit(r) && (i == 0 || !isIdent(rs[i-1])):
+			for i+1 < len(rs) && (unicode.IsDigit(rs[i+1]) || rs[i+1] == '.') {
+				i++
+			}
+			r = '?'
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isIdent(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// operation - первое слово запроса: SELECT, INSERT, BEGIN...
+func operation(sql string) string {
+	f := strings.Fields(sql)
+	if len(f) == 0 {
+		return ""
+	}
+	return strings.ToUpper(f[0])
+}
+
+// Redacted - значение скрытого аргумента в db.args.
+const Redacted = "******"
+
+// RedactFunc решает, можно ли писать в трейс аргумент $i+1 запроса sql.
+type RedactFunc func(sql string, i int, arg interface{}) bool
+
+// RedactColumns скрывает аргументы, которые сравниваются с колонками cols или
+// записываются в них: name = $1, email LIKE $2, INSERT INTO users (name) VALUES ($1).
+func RedactColumns(cols ...string) RedactFunc {
+	set := make(map[string]bool, len(cols))
+	for _, c := range cols {
+		set[strings.ToLower(c)] = true
+	}
+	var cache sync.Map // sql -> map[int]bool
+	return func(sql string, i int, _ interface{}) bool {
+		v, ok := cache.Load(sql)
+		if !ok {
+			v, _ = cache.LoadOrStore(sql, boundColumns(sql, set))
+		}
+		return v.(map[int]bool)[i]
+	}
+}
+
+var (
+	comparedRe = regexp.MustCompile(`(?i)([a-z_][a-z0-9_."]*)\s*(?:=|<>|!=|<=|>=|<|>|\bi?like\b)\s*\$(\d+)`)
+	insertRe   = regexp.MustCompile(`(?is)insert\s+into\s+\S+\s*\(([^)]*)\)\s*values\s*\(([^)]*)\)`)
+)
+
+// boundColumns - индексы аргументов (с нуля), связанных с колонками set.
+func boundColumns(sql string, set map[string]bool) map[int]bool {
+	ret := map[int]bool{}
+	column := func(s string) bool {
+		s = strings.Trim(strings.TrimSpace(s), `"`)
+		if i := strings.LastIndexByte(s, '.'); i >= 0 {
+			s = strings.Trim(s[i+1:], `"`)
+		}
+		return set[strings.ToLower(s)]
+	}
+	arg := func(s string) (int, bool) {
+		s = strings.TrimSpace(s)
+		if !strings.HasPrefix(s, "$") {
+			return 0, false
+		}
+		n, err := strconv.Atoi(s[1:])
+		return n - 1, err == nil && n > 0
+	}
+	for _, m := range comparedRe.FindAllStringSubmatch(sql, -1) {
+		if n, ok := arg("$" + m[2]); ok && column(m[1]) {
+			ret[n] = true
+		}
+	}
+	for _, m := range insertRe.FindAllStringSubmatch(sql, -1) {
+		cols, vals := strings.Split(m[1], ","), strings.Split(m[2], ",")
+		for k := 0; k < len(cols) && k < len(vals); k++ {
+			if n, ok := arg(vals[k]); ok && column(cols[k]) {
+				ret[n] = true
+			}
+		}
+	}
+	return ret
+}
+
+// formatArgs - аргументы для db.args, скрытые заменены на Redacted.
+func formatArgs(sql string, args []interface{}, redact RedactFunc) []string {
+	ret := make([]string, len(args))
+	for i, a := range args {
+		if redact != nil && redact(sql, i, a) {
+			ret[i] = Redacted
+			continue
+		}
+		ret[i] = fmt.Sprint(a)
+	}
+	return ret
+}
@@ -0,0 +1,136 @@
+package pgxtrace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// BatchSizeKey - число запросов в батче.
+	BatchSizeKey = attribute.Key("db.batch.size")
+	// TxOutcomeKey - чем закончилась транзакция: commit или rollback.
+	TxOutcomeKey = attribute.Key("db.transaction.outcome")
+)
+
+// Beginner - *pgxpool.Pool или *pgx.Conn.
+type Beginner interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// Batcher - *pgxpool.Pool, *pgx.Conn или pgx.Tx.
+type Batcher interface {
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+// BeginFunc - как pgx.BeginTxFunc, но вся транзакция в спане "pgx transaction":
+// BEGIN, запросы из f и COMMIT/ROLLBACK становятся его дочерними спанами, если f
+// выполняет запросы с переданным ей ctx.
+func (l *Logger) BeginFunc(ctx context.Context, db Beginner, opts pgx.TxOptions, f func(context.Context, pgx.Tx) error) (err error) {
+	ctx, span := l.tracer.Start(ctx, "pgx transaction",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL),
+	)
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			span.SetAttributes(TxOutcomeKey.String("commit"))
+			return
+		}
+		span.SetAttributes(TxOutcomeKey.String("rollback"))
+		// возвращается ошибка, из-за которой откатили транзакцию, ошибка отката - только в спане
+		if rerr := tx.Rollback(ctx); rerr != nil && !errors.Is(rerr, pgx.ErrTxClosed) {
+			span.RecordError(fmt.Errorf("rollback: %w", rerr))
+		}
+	}()
+
+	if err := f(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// SendBatch отправляет батч в спане "pgx batch", спан заканчивается в Close
+// результата. Каждый запрос батча - дочерний спан.
+func (l *Logger) SendBatch(ctx context.Context, db Batcher, b *pgx.Batch) pgx.BatchResults {
+	ctx, span := l.tracer.Start(ctx, "pgx batch",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, BatchSizeKey.Int(b.Len())),
+	)
+	return &batchResults{BatchResults: db.SendBatch(ctx, b), span: span}
+}
+
+type batchResults struct {
+	pgx.BatchResults
+	span trace.Span
+	err  error // первая ошибка запроса батча
+}
+
+// fail запоминает первую ошибку запроса, ею отмечается спан в Close.
+func (br *batchResults) fail(err error) {
+	if err != nil && br.err == nil {
+		br.err = err
+	}
+}
+
+func (br *batchResults) Exec() (pgconn.CommandTag, error) {
+	ct, err := br.BatchResults.Exec()
+	br.fail(err)
+	return ct, err
+}
+
+func (br *batchResults) Query() (pgx.Rows, error) {
+	rows, err := br.BatchResults.Query()
+	br.fail(err)
+	return rows, err
+}
+
+func (br *batchResults) QueryRow() pgx.Row {
+	return batchRow{Row: br.BatchResults.QueryRow(), br: br}
+}
+
+// batchRow - ошибка QueryRow появляется только в Scan.
+type batchRow struct {
+	pgx.Row
+	br *batchResults
+}
+
+func (r batchRow) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	// пустой результат - не ошибка батча
+	if !errors.Is(err, pgx.ErrNoRows) {
+		r.br.fail(err)
+	}
+	return err
+}
+
+func (br *batchResults) Close() error {
+	err := br.BatchResults.Close()
+	if err == nil {
+		err = br.err
+	}
+	endSpan(br.span, err)
+	return err
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,115 @@
+// Package recovery - перехват паник HTTP-обработчиков. Паника превращается в ответ 500
+// с JSON {"error": "internal server error"}, пишется в лог со стеком и полями запроса,
+// отмечает текущий спан ошибкой и увеличивает счётчик <namespace>_http_panics_total{route}.
+// Middleware для net/http (chi) - Recovery.Middleware, для gin - пакет recoverygin.
+//
+// Recovery подключается после requestid и снаружи sentryreport: сначала паника уходит
+// в Sentry, затем обрабатывается здесь.
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/Deny7676yar/observability/pkg/logctx"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	// LabelRoute - метка маршрута у счётчика паник.
+	LabelRoute = "route"
+	// Message - текст ошибки в ответе клиенту; подробности паники остаются в логе.
+	Message = "internal server error"
+
+	// unmatchedRoute - метка для запросов, не попавших ни в один маршрут.
+	unmatchedRoute = "unmatched"
+)
+
+// Panic - перехваченная паника и стек горутины, в которой она случилась.
+type Panic struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *Panic) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// Recovery - счётчик паник и middleware, которые его ведут.
+type Recovery struct {
+	panics *prometheus.CounterVec
+}
+
+// New создаёт счётчик паник и регистрирует его в reg.
+func New(reg prometheus.Registerer, namespace string) (*Recovery, error) {
+	rc := &Recovery{
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "panics_total",
+			Help:      "The number of panics recovered in HTTP handlers",
+		}, []string{LabelRoute}),
+	}
+	if err := reg.Register(rc.panics); err != nil {
+		return nil, fmt.Errorf("register panic metrics: %w", err)
+	}
+	return rc, nil
+}
+
+// Recovered учитывает панику p в маршруте route: увеличивает счётчик и отмечает спан
+// из ctx ошибкой. Вызывается из deferred-функции middleware, стек берётся оттуда же.
+// Пустой route - запрос не попал ни в один маршрут.
+func (rc *Recovery) Recovered(ctx context.Context, route string, p interface{}) *Panic {
+	if route == "" {
+		route = unmatchedRoute
+	}
+	rp := &Panic{Value: p, Stack: debug.Stack()}
+	rc.panics.WithLabelValues(route).Inc()
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(rp, trace.WithAttributes(semconv.ExceptionStacktraceKey.String(string(rp.Stack))))
+	span.SetStatus(codes.Error, rp.Error())
+	return rp
+}
+
+// Middleware - middleware для net/http и chi. route возвращает шаблон маршрута запроса
+// (/users/{id}) после того, как роутер его выбрал; сырой путь в метку не пишем.
+// http.ErrAbortHandler не перехватывается: им обработчик прерывает ответ намеренно.
+func (rc *Recovery) Middleware(logger *zap.Logger, route func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				pattern := route(r)
+				rp := rc.Recovered(r.Context(), pattern, p)
+				logctx.Zap(r.Context(), logger).Error("panic recovered",
+					zap.String(logctx.PanicKey, fmt.Sprint(p)),
+					zap.String(LabelRoute, pattern),
+					zap.String("method", r.Method),
+					zap.String("path", r.URL.Path),
+					zap.ByteString("stack", rp.Stack),
+				)
+				WriteError(w)
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WriteError пишет ответ 500 с телом {"error": Message}.
+func WriteError(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	_, _ = fmt.Fprintf(w, "{\"error\":%q}\n", Message)
+}
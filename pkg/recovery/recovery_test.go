@@ -0,0 +1,110 @@
+package recovery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Deny7676yar/observability/pkg/logctx"
+	"github.com/Deny7676yar/observability/pkg/requestid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(RecoverySuite))
+
+type RecoverySuite struct {
+	rc   *Recovery
+	sr   *tracetest.SpanRecorder
+	tp   *sdktrace.TracerProvider
+	logs *observer.ObservedLogs
+	h    http.Handler
+}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *RecoverySuite) SetUpTest(c *gc.C) {
+	var err error
+	s.rc, err = New(prometheus.NewRegistry(), "test")
+	c.Assert(err, gc.IsNil)
+	s.sr = tracetest.NewSpanRecorder()
+	s.tp = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(s.sr))
+	core, logs := observer.New(zapcore.DebugLevel)
+	s.logs = logs
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["x"] = 1
+	})
+	mux.HandleFunc("/abort", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	route := func(r *http.Request) string {
+		if strings.HasPrefix(r.URL.Path, "/users/") {
+			return "/users/{id}"
+		}
+		return ""
+	}
+	h := requestid.Middleware(s.rc.Middleware(zap.New(core), route)(mux))
+	s.h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := s.tp.Tracer("test").Start(r.Context(), "server")
+		defer span.End()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (s *RecoverySuite) TestPanicBecomes500(c *gc.C) {
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set(requestid.Header, "req-1")
+	rec := httptest.NewRecorder()
+	s.h.ServeHTTP(rec, req)
+
+	c.Assert(rec.Code, gc.Equals, http.StatusInternalServerError)
+	c.Assert(rec.Header().Get("Content-Type"), gc.Equals, "application/json")
+	c.Assert(rec.Body.String(), gc.Equals, "{\"error\":\"internal server error\"}\n")
+
+	c.Assert(testutil.ToFloat64(s.rc.panics.WithLabelValues("/users/{id}")), gc.Equals, 1.0)
+
+	span := s.sr.Ended()[0]
+	c.Assert(span.Status().Code, gc.Equals, codes.Error)
+	c.Assert(span.Events()[0].Name, gc.Equals, "exception")
+
+	entries := s.logs.FilterMessage("panic recovered").All()
+	c.Assert(entries, gc.HasLen, 1)
+	fields := entries[0].ContextMap()
+	c.Assert(fields[logctx.PanicKey], gc.Matches, ".*nil map.*")
+	c.Assert(fields[LabelRoute], gc.Equals, "/users/{id}")
+	c.Assert(fields[logctx.RequestIDKey], gc.Equals, "req-1")
+	c.Assert(fields[logctx.TraceIDKey], gc.Equals, span.SpanContext().TraceID().String())
+	c.Assert(fields["stack"], gc.Matches, "(?s).*recovery.*")
+}
+
+func (s *RecoverySuite) TestUnmatchedRoute(c *gc.C) {
+	rc := s.rc.Middleware(zap.NewNop(), func(*http.Request) string { return "" })
+	h := rc(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nope", nil))
+	c.Assert(rec.Code, gc.Equals, http.StatusInternalServerError)
+	c.Assert(testutil.ToFloat64(s.rc.panics.WithLabelValues(unmatchedRoute)), gc.Equals, 1.0)
+}
+
+func (s *RecoverySuite) TestAbortHandlerPassesThrough(c *gc.C) {
+	defer func() {
+		c.Assert(recover(), gc.Equals, http.ErrAbortHandler)
+		c.Assert(s.logs.Len(), gc.Equals, 0)
+	}()
+	s.h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+}
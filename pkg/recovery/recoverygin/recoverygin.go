@@ -0,0 +1,45 @@
+// Package recoverygin - recovery.Recovery для gin.
+package recoverygin
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Deny7676yar/observability/pkg/logctx"
+	"github.com/Deny7676yar/observability/pkg/recovery"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Middleware перехватывает панику обработчика: ответ 500, запись в logger со стеком,
+// ошибка в спане и счётчик паник rc. Маршрут берётся из шаблона gin (/read/:id).
+// Подключается после requestidgin.Middleware и до sentryreportgin.Middleware.
+func Middleware(rc *recovery.Recovery, logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			ctx := c.Request.Context()
+			rp := rc.Recovered(ctx, c.FullPath(), p)
+			logger.WithContext(ctx).WithFields(logrus.Fields{
+				logctx.PanicKey:     fmt.Sprint(p),
+				recovery.LabelRoute: c.FullPath(),
+				"method":            c.Request.Method,
+				"path":              c.Request.URL.Path,
+				"stack":             string(rp.Stack),
+			}).Error("panic recovered")
+			if c.Writer.Written() {
+				// ответ уже начат, заголовок 500 не отправить
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": recovery.Message})
+		}()
+		c.Next()
+	}
+}
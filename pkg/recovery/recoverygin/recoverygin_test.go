@@ -0,0 +1,62 @@
+package recoverygin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Deny7676yar/observability/pkg/logctx"
+	"github.com/Deny7676yar/observability/pkg/recovery"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(GinSuite))
+
+type GinSuite struct{}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *GinSuite) TestMiddleware(c *gc.C) {
+	gin.SetMode(gin.TestMode)
+	reg := prometheus.NewRegistry()
+	rc, err := recovery.New(reg, "test")
+	c.Assert(err, gc.IsNil)
+	l, hook := logrustest.NewNullLogger()
+
+	r := gin.New()
+	r.Use(Middleware(rc, l))
+	r.GET("/read/:id", func(c *gin.Context) {
+		panic("boom")
+	})
+	r.GET("/search/:q", func(c *gin.Context) {
+		c.String(http.StatusOK, "partial")
+		panic("mid-stream")
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/read/1", nil))
+	c.Assert(rec.Code, gc.Equals, http.StatusInternalServerError)
+	c.Assert(rec.Body.String(), gc.Equals, `{"error":"internal server error"}`)
+
+	e := hook.LastEntry()
+	c.Assert(e.Level, gc.Equals, logrus.ErrorLevel)
+	c.Assert(e.Message, gc.Equals, "panic recovered")
+	c.Assert(e.Data[logctx.PanicKey], gc.Equals, "boom")
+	c.Assert(e.Data[recovery.LabelRoute], gc.Equals, "/read/:id")
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search/go", nil))
+	c.Assert(rec.Code, gc.Equals, http.StatusOK, gc.Commentf("status already sent"))
+	c.Assert(rec.Body.String(), gc.Equals, "partial")
+
+	n, err := testutil.GatherAndCount(reg, "test_http_panics_total")
+	c.Assert(err, gc.IsNil)
+	c.Assert(n, gc.Equals, 2)
+}
@@ -0,0 +1,110 @@
+// Package requestid - идентификатор запроса X-Request-ID: middleware для net/http (chi)
+// принимает его из запроса или создаёт новый, кладёт в контекст, возвращает в ответе
+// и пишет в атрибут текущего спана. Transport передаёт его в исходящие запросы.
+// Middleware для gin - в пакете requestidgin.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Header - заголовок с идентификатором запроса.
+const Header = "X-Request-ID"
+
+// AttributeKey - атрибут спана с идентификатором запроса.
+const AttributeKey = attribute.Key("http.request_id")
+
+// maxLen - входящие идентификаторы длиннее заменяются новыми.
+const maxLen = 128
+
+type ctxKey struct{}
+
+// NewContext возвращает ctx с идентификатором запроса id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext - идентификатор запроса из ctx или "", если его нет.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// New - случайный идентификатор из 32 hex-символов.
+func New() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// valid - идентификатор от клиента принимается, если он не длиннее maxLen и состоит
+// из печатных ASCII-символов без пробелов: он попадает в логи и заголовки ответа.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Accept - идентификатор для входящего запроса r: из заголовка или новый. Возвращает
+// контекст с идентификатором и выставляет заголовок ответа w.
+func Accept(ctx context.Context, r *http.Request, w http.Header) context.Context {
+	id := r.Header.Get(Header)
+	if !valid(id) {
+		id = New()
+	}
+	w.Set(Header, id)
+	trace.SpanFromContext(ctx).SetAttributes(AttributeKey.String(id))
+	return NewContext(ctx, id)
+}
+
+// Middleware - middleware для net/http и chi. Чтобы идентификатор попал в серверный
+// спан, подключается внутри otelhttp.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := Accept(r.Context(), r, w.Header())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Transport передаёт идентификатор запроса из контекста исходящего запроса в заголовке
+// Header. Заголовок, уже выставленный вызывающим, не меняется.
+type Transport struct {
+	// Base - транспорт для отправки, nil - http.DefaultTransport.
+	Base http.RoundTripper
+	// Generate - создавать новый идентификатор, если в контексте его нет
+	// (клиент - начало цепочки, например нагрузочный тест).
+	Generate bool
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if r.Header.Get(Header) != "" {
+		return base.RoundTrip(r)
+	}
+	id := FromContext(r.Context())
+	if id == "" && t.Generate {
+		id = New()
+	}
+	if id == "" {
+		return base.RoundTrip(r)
+	}
+	// RoundTripper не должен менять исходный запрос
+	r = r.Clone(r.Context())
+	r.Header.Set(Header, id)
+	return base.RoundTrip(r)
+}
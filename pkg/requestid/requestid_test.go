@@ -0,0 +1,99 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(RequestIDSuite))
+
+type RequestIDSuite struct{}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+// serve прогоняет запрос с заголовком id (пусто - без заголовка) через h и возвращает
+// идентификатор, увиденный обработчиком, и ответ.
+func serve(h func(http.Handler) http.Handler, id string) (string, *httptest.ResponseRecorder) {
+	var seen string
+	handler := h(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	if id != "" {
+		req.Header.Set(Header, id)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return seen, rec
+}
+
+func (s *RequestIDSuite) TestAcceptOrGenerate(c *gc.C) {
+	seen, rec := serve(Middleware, "client-id-1")
+	c.Assert(seen, gc.Equals, "client-id-1")
+	c.Assert(rec.Header().Get(Header), gc.Equals, "client-id-1")
+
+	seen, rec = serve(Middleware, "")
+	c.Assert(seen, gc.Matches, "[0-9a-f]{32}")
+	c.Assert(rec.Header().Get(Header), gc.Equals, seen)
+
+	for _, bad := range []string{"with space", "line\nbreak", strings.Repeat("x", maxLen+1)} {
+		seen, _ = serve(Middleware, bad)
+		c.Assert(seen, gc.Matches, "[0-9a-f]{32}", gc.Commentf("%q must be replaced", bad))
+	}
+}
+
+func (s *RequestIDSuite) TestSpanAttribute(c *gc.C) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	withSpan := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, span := tp.Tracer("test").Start(r.Context(), "server")
+			defer span.End()
+			Middleware(next).ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+	serve(withSpan, "abc")
+	attrs := sr.Ended()[0].Attributes()
+	c.Assert(attrs, gc.HasLen, 1)
+	c.Assert(attrs[0].Key, gc.Equals, AttributeKey)
+	c.Assert(attrs[0].Value.AsString(), gc.Equals, "abc")
+}
+
+func (s *RequestIDSuite) TestTransport(c *gc.C) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get(Header))
+	}))
+	defer srv.Close()
+	get := func(t *Transport, ctx context.Context, header string) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		c.Assert(err, gc.IsNil)
+		if header != "" {
+			req.Header.Set(Header, header)
+		}
+		resp, err := (&http.Client{Transport: t}).Do(req)
+		c.Assert(err, gc.IsNil)
+		resp.Body.Close()
+		c.Assert(req.Header.Get(Header), gc.Equals, header, gc.Commentf("request must not be modified"))
+	}
+
+	get(&Transport{}, NewContext(context.Background(), "from-ctx"), "")
+	get(&Transport{}, context.Background(), "")
+	get(&Transport{Generate: true}, context.Background(), "")
+	get(&Transport{Generate: true}, NewContext(context.Background(), "from-ctx"), "explicit")
+
+	c.Assert(got, gc.HasLen, 4)
+	c.Assert(got[0], gc.Equals, "from-ctx")
+	c.Assert(got[1], gc.Equals, "")
+	c.Assert(got[2], gc.Matches, "[0-9a-f]{32}")
+	c.Assert(got[3], gc.Equals, "explicit")
+}
@@ -0,0 +1,15 @@
+// Package requestidgin - requestid.Middleware для gin.
+package requestidgin
+
+import (
+	"github.com/Deny7676yar/observability/pkg/requestid"
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware принимает X-Request-ID из запроса или создаёт новый, см. requestid.Accept.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(requestid.Accept(c.Request.Context(), c.Request, c.Writer.Header()))
+		c.Next()
+	}
+}
@@ -0,0 +1,41 @@
+package requestidgin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Deny7676yar/observability/pkg/requestid"
+	"github.com/gin-gonic/gin"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(GinSuite))
+
+type GinSuite struct{}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *GinSuite) TestMiddleware(c *gc.C) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	var seen string
+	r.GET("/read/:id", func(c *gin.Context) {
+		seen = requestid.FromContext(c.Request.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/read/1", nil)
+	req.Header.Set(requestid.Header, "from-client")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	c.Assert(seen, gc.Equals, "from-client")
+	c.Assert(rec.Header().Get(requestid.Header), gc.Equals, "from-client")
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/read/1", nil))
+	c.Assert(seen, gc.Matches, "[0-9a-f]{32}")
+	c.Assert(rec.Header().Get(requestid.Header), gc.Equals, seen)
+}
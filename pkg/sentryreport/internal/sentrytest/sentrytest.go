@@ -0,0 +1,106 @@
+// Package sentrytest - фейковый Sentry для тестов sentryreport и его адаптеров.
+package sentrytest
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Event - то, что дошло до фейкового Sentry.
+type Event struct {
+	Level     string                 `json:"level"`
+	Message   string                 `json:"message"`
+	Tags      map[string]string      `json:"tags"`
+	Extra     map[string]interface{} `json:"extra"`
+	Exception []struct {
+		Type       string      `json:"type"`
+		Value      string      `json:"value"`
+		Stacktrace *Stacktrace `json:"stacktrace"`
+	} `json:"exception"`
+	Threads []struct {
+		Stacktrace *Stacktrace `json:"stacktrace"`
+	} `json:"threads"`
+	Request *struct {
+		URL     string            `json:"url"`
+		Method  string            `json:"method"`
+		Headers map[string]string `json:"headers"`
+	} `json:"request"`
+	Contexts map[string]map[string]interface{} `json:"contexts"`
+}
+
+type Stacktrace struct {
+	Frames []Frame `json:"frames"`
+}
+
+type Frame struct {
+	Function string `json:"function"`
+}
+
+// HasFrame - есть ли в frames функция, имя которой содержит fn.
+func HasFrame(frames []Frame, fn string) bool {
+	for _, f := range frames {
+		if strings.Contains(f.Function, fn) {
+			return true
+		}
+	}
+	return false
+}
+
+// Server - локальный DSN: принимает события (store) и конверты (envelope) и запоминает их.
+type Server struct {
+	*httptest.Server
+	mu     sync.Mutex
+	events []Event
+}
+
+func NewServer() *Server {
+	f := &Server{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payloads []string
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/store/"):
+			b, _ := io.ReadAll(r.Body)
+			payloads = append(payloads, string(b))
+		case strings.HasSuffix(r.URL.Path, "/envelope/"):
+			// заголовок конверта, затем пары "заголовок элемента" - "данные"
+			sc := bufio.NewScanner(r.Body)
+			sc.Buffer(nil, 1<<20)
+			var lines []string
+			for sc.Scan() {
+				lines = append(lines, sc.Text())
+			}
+			for i := 2; i < len(lines); i += 2 {
+				payloads = append(payloads, lines[i])
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, p := range payloads {
+			var e Event
+			if err := json.Unmarshal([]byte(p), &e); err == nil {
+				f.events = append(f.events, e)
+			}
+		}
+	}))
+	return f
+}
+
+// DSN - DSN проекта 1 на этом сервере.
+func (f *Server) DSN() string {
+	return strings.Replace(f.URL, "http://", "http://public@", 1) + "/1"
+}
+
+// Events - принятые события.
+func (f *Server) Events() []Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Event(nil), f.events...)
+}
@@ -0,0 +1,134 @@
+package sentryreport
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Deny7676yar/observability/pkg/logctx"
+	"github.com/getsentry/sentry-go"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// WrapZap возвращает l, который дополнительно отправляет в hub записи уровня error и выше.
+// Поля trace_id, span_id и request_id (см. logctx.Zap) становятся тегами события,
+// поле zap.Error - исключением, остальные поля - extra. Записи с полем logctx.PanicKey
+// пропускаются: паника уже отправлена Middleware.
+func WrapZap(l *zap.Logger, hub *sentry.Hub) *zap.Logger {
+	if hub == nil {
+		return l
+	}
+	return l.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(c, &zapCore{hub: hub})
+	}))
+}
+
+type zapCore struct {
+	hub    *sentry.Hub
+	fields []zapcore.Field
+}
+
+func (c *zapCore) Enabled(l zapcore.Level) bool {
+	return l >= zapcore.ErrorLevel
+}
+
+func (c *zapCore) With(fields []zapcore.Field) zapcore.Core {
+	all := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	return &zapCore{hub: c.hub, fields: append(append(all, c.fields...), fields...)}
+}
+
+func (c *zapCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *zapCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	all := append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	for _, f := range all {
+		if f.Key == logctx.PanicKey {
+			return nil
+		}
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	var err error
+	for _, f := range all {
+		if e, ok := f.Interface.(error); ok && f.Type == zapcore.ErrorType && err == nil {
+			err = e
+			continue
+		}
+		f.AddTo(enc)
+	}
+	tags, extra := split(enc.Fields)
+	capture(context.Background(), c.hub, zapLevel(ent.Level), ent.Message, err, tags, extra)
+	if ent.Level > zapcore.ErrorLevel {
+		// после DPanic, Panic и Fatal процесс может не дожить до фоновой отправки
+		c.hub.Flush(FlushTimeout)
+	}
+	return nil
+}
+
+func (c *zapCore) Sync() error {
+	c.hub.Flush(FlushTimeout)
+	return nil
+}
+
+func zapLevel(l zapcore.Level) sentry.Level {
+	if l > zapcore.ErrorLevel {
+		return sentry.LevelFatal
+	}
+	return sentry.LevelError
+}
+
+// LogrusHook отправляет в Hub записи уровня error и выше. Для записей с контекстом
+// (log.WithContext(ctx)) используется хаб запроса и идентификаторы трейса из ctx.
+// Записи с полем logctx.PanicKey пропускаются, как и в WrapZap.
+type LogrusHook struct {
+	Hub *sentry.Hub
+}
+
+func (h LogrusHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel}
+}
+
+func (h LogrusHook) Fire(e *logrus.Entry) error {
+	if _, ok := e.Data[logctx.PanicKey]; ok {
+		return nil
+	}
+	data := make(map[string]interface{}, len(e.Data))
+	var err error
+	for k, v := range e.Data {
+		if k == logrus.ErrorKey {
+			if ev, ok := v.(error); ok {
+				err = ev
+				continue
+			}
+		}
+		data[k] = v
+	}
+	tags, extra := split(data)
+	level := sentry.LevelError
+	if e.Level < logrus.ErrorLevel {
+		level = sentry.LevelFatal
+	}
+	capture(e.Context, h.Hub, level, e.Message, err, tags, extra)
+	if hub := fromContext(e.Context, h.Hub); hub != nil && level == sentry.LevelFatal {
+		// logrus.Fatal завершит процесс сразу после хуков
+		hub.Flush(FlushTimeout)
+	}
+	return nil
+}
+
+// split отделяет поля корреляции (теги) от остальных полей записи.
+func split(fields map[string]interface{}) (map[string]string, map[string]interface{}) {
+	tags := map[string]string{}
+	for _, k := range []string{logctx.TraceIDKey, logctx.SpanIDKey, logctx.RequestIDKey} {
+		if v, ok := fields[k]; ok {
+			tags[k] = fmt.Sprint(v)
+			delete(fields, k)
+		}
+	}
+	return tags, fields
+}
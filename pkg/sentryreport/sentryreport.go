@@ -0,0 +1,151 @@
+// Package sentryreport - отправка паник и ошибок из логов в Sentry.
+//
+// Middleware (chi, net/http) и sentryreportgin.Middleware (gin) отправляют паники
+// обработчиков со стеком и данными запроса, после чего паника идёт дальше, к recovery.
+// WrapZap и LogrusHook отправляют записи уровня error и выше. К каждому событию
+// добавляются теги trace_id, span_id и request_id из контекста, по trace_id событие
+// находится в Jaeger.
+package sentryreport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Deny7676yar/observability/pkg/logctx"
+	"github.com/Deny7676yar/observability/pkg/requestid"
+	"github.com/getsentry/sentry-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// FlushTimeout - сколько ждать отправки событий при остановке сервиса.
+const FlushTimeout = 2 * time.Second
+
+// Config - настройки Sentry, встраиваются в Config сервиса. Без DSN события не отправляются.
+type Config struct {
+	DSN         string `json:"dsn" env:"SENTRY_DSN" secret:"true"`
+	Environment string `json:"environment" env:"SENTRY_ENVIRONMENT" default:"development"`
+	Release     string `json:"release" env:"SENTRY_RELEASE"`
+}
+
+// NewHub создаёт клиент Sentry для сервиса service. opts меняют настройки клиента,
+// например транспорт в тестах.
+func NewHub(cfg Config, service string, opts ...func(*sentry.ClientOptions)) (*sentry.Hub, error) {
+	co := sentry.ClientOptions{
+		Dsn:              cfg.DSN,
+		Environment:      cfg.Environment,
+		Release:          cfg.Release,
+		AttachStacktrace: true,
+	}
+	for _, o := range opts {
+		o(&co)
+	}
+	client, err := sentry.NewClient(co)
+	if err != nil {
+		return nil, fmt.Errorf("sentry: %w", err)
+	}
+	scope := sentry.NewScope()
+	scope.SetTag("service", service)
+	return sentry.NewHub(client, scope), nil
+}
+
+// fromContext - хаб запроса, положенный Middleware, иначе hub.
+func fromContext(ctx context.Context, hub *sentry.Hub) *sentry.Hub {
+	if ctx != nil {
+		if h := sentry.GetHubFromContext(ctx); h != nil {
+			return h
+		}
+	}
+	return hub
+}
+
+// correlate добавляет в событие идентификаторы трейса и запроса из ctx.
+func correlate(ctx context.Context, scope *sentry.Scope) {
+	if ctx == nil {
+		return
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		scope.SetTag(logctx.TraceIDKey, sc.TraceID().String())
+		scope.SetTag(logctx.SpanIDKey, sc.SpanID().String())
+		scope.SetContext("trace", map[string]interface{}{
+			"trace_id": sc.TraceID().String(),
+			"span_id":  sc.SpanID().String(),
+		})
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		scope.SetTag(logctx.RequestIDKey, id)
+	}
+}
+
+// RequestContext - контекст запроса r со своим хабом, в котором уже есть данные запроса.
+// Без hub (Sentry не настроен) возвращает контекст r.
+func RequestContext(hub *sentry.Hub, r *http.Request) context.Context {
+	if hub == nil {
+		return r.Context()
+	}
+	h := hub.Clone()
+	h.Scope().SetRequest(r)
+	return sentry.SetHubOnContext(r.Context(), h)
+}
+
+// Repanic вызывается через defer в middleware: отправляет панику в Sentry и паникует
+// снова. ctx - контекст от RequestContext.
+func Repanic(ctx context.Context) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	if p != http.ErrAbortHandler {
+		CapturePanic(ctx, p)
+	}
+	panic(p)
+}
+
+// CapturePanic отправляет панику p со стеком текущей горутины.
+func CapturePanic(ctx context.Context, p interface{}) {
+	hub := fromContext(ctx, nil)
+	if hub == nil {
+		return
+	}
+	hub.WithScope(func(scope *sentry.Scope) {
+		correlate(ctx, scope)
+		hub.RecoverWithContext(ctx, p)
+	})
+}
+
+// Middleware - middleware для net/http и chi. Подключается после requestid.Middleware
+// и внутри otelhttp, чтобы у события были идентификаторы запроса и трейса.
+func Middleware(hub *sentry.Hub) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := RequestContext(hub, r)
+			defer Repanic(ctx)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// capture отправляет запись лога: с исключением, если есть err, иначе сообщением со стеком.
+func capture(ctx context.Context, hub *sentry.Hub, level sentry.Level, msg string, err error,
+	tags map[string]string, extra map[string]interface{}) {
+	hub = fromContext(ctx, hub)
+	if hub == nil || hub.Client() == nil {
+		return
+	}
+	hub.WithScope(func(scope *sentry.Scope) {
+		correlate(ctx, scope)
+		scope.SetLevel(level)
+		scope.SetTags(tags)
+		scope.SetExtras(extra)
+		if err == nil {
+			hub.CaptureMessage(msg)
+			return
+		}
+		scope.AddEventProcessor(func(e *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+			e.Message = msg
+			return e
+		})
+		hub.CaptureException(err)
+	})
+}
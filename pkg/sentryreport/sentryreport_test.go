@@ -0,0 +1,167 @@
+package sentryreport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Deny7676yar/observability/pkg/logctx"
+	"github.com/Deny7676yar/observability/pkg/loglevel"
+	"github.com/Deny7676yar/observability/pkg/requestid"
+	"github.com/Deny7676yar/observability/pkg/sentryreport/internal/sentrytest"
+	"github.com/getsentry/sentry-go"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(SentrySuite))
+
+type SentrySuite struct {
+	fake *sentrytest.Server
+	hub  *sentry.Hub
+	tp   *sdktrace.TracerProvider
+}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *SentrySuite) SetUpTest(c *gc.C) {
+	s.fake = sentrytest.NewServer()
+	var err error
+	s.hub, err = NewHub(Config{DSN: s.fake.DSN(), Environment: "test"}, "svc")
+	c.Assert(err, gc.IsNil)
+	s.tp = sdktrace.NewTracerProvider()
+}
+
+func (s *SentrySuite) TearDownTest(c *gc.C) {
+	s.fake.Close()
+}
+
+func (s *SentrySuite) flush(c *gc.C, n int) []sentrytest.Event {
+	c.Assert(s.hub.Flush(FlushTimeout), gc.Equals, true)
+	ev := s.fake.Events()
+	c.Assert(ev, gc.HasLen, n)
+	return ev
+}
+
+func panickingHandler(w http.ResponseWriter, r *http.Request) {
+	panic(errors.New("nil map write"))
+}
+
+func (s *SentrySuite) TestMiddlewareReportsPanicAndRepanics(c *gc.C) {
+	h := requestid.Middleware(Middleware(s.hub)(http.HandlerFunc(panickingHandler)))
+	ctx, sp := s.tp.Tracer("test").Start(context.Background(), "server")
+	req := httptest.NewRequest(http.MethodGet, "/users/1?x=1", nil).WithContext(ctx)
+	req.Header.Set(requestid.Header, "req-7")
+
+	func() {
+		defer func() {
+			c.Assert(recover(), gc.ErrorMatches, "nil map write", gc.Commentf("panic must reach recovery"))
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	sp.End()
+
+	e := s.flush(c, 1)[0]
+	c.Assert(e.Level, gc.Equals, "fatal")
+	c.Assert(e.Exception, gc.HasLen, 1)
+	c.Assert(e.Exception[0].Value, gc.Equals, "nil map write")
+	c.Assert(e.Exception[0].Stacktrace, gc.NotNil)
+	c.Assert(sentrytest.HasFrame(e.Exception[0].Stacktrace.Frames, "panickingHandler"), gc.Equals, true)
+	c.Assert(e.Tags[logctx.TraceIDKey], gc.Equals, sp.SpanContext().TraceID().String())
+	c.Assert(e.Tags[logctx.RequestIDKey], gc.Equals, "req-7")
+	c.Assert(e.Tags["service"], gc.Equals, "svc")
+	c.Assert(e.Request, gc.NotNil)
+	c.Assert(e.Request.Method, gc.Equals, http.MethodGet)
+	c.Assert(e.Request.URL, gc.Matches, ".*/users/1")
+	c.Assert(e.Contexts["trace"]["trace_id"], gc.Equals, sp.SpanContext().TraceID().String())
+}
+
+func (s *SentrySuite) TestZapErrors(c *gc.C) {
+	l := WrapZap(zap.NewNop(), s.hub)
+	ctx, sp := s.tp.Tracer("test").Start(requestid.NewContext(context.Background(), "req-8"), "handler")
+	logctx.Zap(ctx, l).Info("not reported")
+	logctx.Zap(ctx, l).With(zap.String("user", "42")).Error("failed to get user", zap.Error(errors.New("timeout")))
+	l.Error("no error field")
+	l.Error("panic recovered", zap.String(logctx.PanicKey, "boom"))
+	sp.End()
+
+	ev := s.flush(c, 2)
+	byMsg := map[string]sentrytest.Event{}
+	for _, e := range ev {
+		byMsg[e.Message] = e
+	}
+	e := byMsg["failed to get user"]
+	c.Assert(e.Level, gc.Equals, "error")
+	c.Assert(e.Exception, gc.HasLen, 1)
+	c.Assert(e.Exception[0].Value, gc.Equals, "timeout")
+	c.Assert(e.Tags[logctx.TraceIDKey], gc.Equals, sp.SpanContext().TraceID().String())
+	c.Assert(e.Tags[logctx.RequestIDKey], gc.Equals, "req-8")
+	c.Assert(e.Extra["user"], gc.Equals, "42")
+
+	e = byMsg["no error field"]
+	c.Assert(e.Exception, gc.HasLen, 0)
+	c.Assert(e.Threads, gc.HasLen, 1, gc.Commentf("message events carry the stack"))
+}
+
+func (s *SentrySuite) TestZapWithLevelsAndSpan(c *gc.C) {
+	levels, err := loglevel.New("debug")
+	c.Assert(err, gc.IsNil)
+	core, logs := observer.New(zapcore.DebugLevel)
+	l := levels.Named(WrapZap(levels.Wrap(zap.New(core)), s.hub), "http")
+	c.Assert(levels.Set(context.Background(), "http", zapcore.WarnLevel, 0), gc.IsNil)
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	ctx, sp := tp.Tracer("test").Start(context.Background(), "handler")
+
+	logctx.Zap(ctx, l).Info("request served")
+	logctx.Zap(ctx, l).Error("failed to get user")
+	sp.End()
+
+	ev := s.flush(c, 1)
+	c.Assert(ev[0].Message, gc.Equals, "failed to get user")
+	var written []string
+	for _, e := range logs.All() {
+		if e.LoggerName == "http" {
+			written = append(written, e.Message)
+		}
+	}
+	c.Assert(written, gc.DeepEquals, []string{"failed to get user"}, gc.Commentf("info is below the http level"))
+	c.Assert(sr.Ended()[0].Events(), gc.HasLen, 1)
+}
+
+func (s *SentrySuite) TestLogrusHook(c *gc.C) {
+	l, _ := logrustest.NewNullLogger()
+	l.AddHook(LogrusHook{Hub: s.hub})
+	ctx, sp := s.tp.Tracer("test").Start(requestid.NewContext(context.Background(), "req-9"), "handler")
+	req := httptest.NewRequest(http.MethodPost, "/create", nil)
+	ctx = RequestContext(s.hub, req.WithContext(ctx))
+
+	l.WithContext(ctx).Warn("not reported")
+	l.WithContext(ctx).WithError(errors.New("duplicate key")).WithField("alias", "go").Error("create link failed")
+	sp.End()
+
+	e := s.flush(c, 1)[0]
+	c.Assert(e.Message, gc.Equals, "create link failed")
+	c.Assert(e.Exception[0].Value, gc.Equals, "duplicate key")
+	c.Assert(e.Extra["alias"], gc.Equals, "go")
+	c.Assert(e.Tags[logctx.TraceIDKey], gc.Equals, sp.SpanContext().TraceID().String())
+	c.Assert(e.Tags[logctx.RequestIDKey], gc.Equals, "req-9")
+	c.Assert(e.Request, gc.NotNil, gc.Commentf("request data comes from the request hub"))
+	c.Assert(e.Request.URL, gc.Matches, ".*/create")
+}
+
+func (s *SentrySuite) TestNoDSN(c *gc.C) {
+	hub, err := NewHub(Config{}, "svc")
+	c.Assert(err, gc.IsNil)
+	WrapZap(zap.NewNop(), hub).Error("dropped")
+	c.Assert(hub.Flush(FlushTimeout), gc.Equals, true)
+}
@@ -0,0 +1,19 @@
+// Package sentryreportgin - sentryreport.Middleware для gin.
+package sentryreportgin
+
+import (
+	"github.com/Deny7676yar/observability/pkg/sentryreport"
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware отправляет панику обработчика в Sentry и передаёт её дальше, к recovery gin.
+// Подключается после requestidgin.Middleware.
+func Middleware(hub *sentry.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := sentryreport.RequestContext(hub, c.Request)
+		c.Request = c.Request.WithContext(ctx)
+		defer sentryreport.Repanic(ctx)
+		c.Next()
+	}
+}
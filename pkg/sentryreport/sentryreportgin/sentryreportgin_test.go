@@ -0,0 +1,64 @@
+package sentryreportgin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Deny7676yar/observability/pkg/logctx"
+	"github.com/Deny7676yar/observability/pkg/requestid"
+	"github.com/Deny7676yar/observability/pkg/requestid/requestidgin"
+	"github.com/Deny7676yar/observability/pkg/sentryreport"
+	"github.com/Deny7676yar/observability/pkg/sentryreport/internal/sentrytest"
+	"github.com/gin-gonic/gin"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(GinSuite))
+
+type GinSuite struct{}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func panickingHandler(c *gin.Context) {
+	panic(errors.New("nil map write"))
+}
+
+func (s *GinSuite) TestReportsPanicAndRepanics(c *gc.C) {
+	fake := sentrytest.NewServer()
+	defer fake.Close()
+	hub, err := sentryreport.NewHub(sentryreport.Config{DSN: fake.DSN(), Environment: "test"}, "svc")
+	c.Assert(err, gc.IsNil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var recovered interface{}
+	r.Use(gin.CustomRecovery(func(c *gin.Context, err interface{}) {
+		recovered = err
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}), requestidgin.Middleware(), Middleware(hub))
+	r.GET("/read/:id", panickingHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/read/1", nil)
+	req.Header.Set(requestid.Header, "req-7")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	c.Assert(recovered, gc.ErrorMatches, "nil map write", gc.Commentf("panic must reach recovery"))
+	c.Assert(rec.Code, gc.Equals, http.StatusInternalServerError)
+	c.Assert(hub.Flush(sentryreport.FlushTimeout), gc.Equals, true)
+	ev := fake.Events()
+	c.Assert(ev, gc.HasLen, 1)
+	e := ev[0]
+	c.Assert(e.Level, gc.Equals, "fatal")
+	c.Assert(e.Exception, gc.HasLen, 1)
+	c.Assert(e.Exception[0].Value, gc.Equals, "nil map write")
+	c.Assert(e.Exception[0].Stacktrace, gc.NotNil)
+	c.Assert(sentrytest.HasFrame(e.Exception[0].Stacktrace.Frames, "panickingHandler"), gc.Equals, true)
+	c.Assert(e.Tags[logctx.RequestIDKey], gc.Equals, "req-7")
+	c.Assert(e.Request, gc.NotNil)
+	c.Assert(e.Request.URL, gc.Matches, ".*/read/1")
+}
@@ -0,0 +1,334 @@
+package tracing
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	StrategyConst         = "const"
+	StrategyProbabilistic = "probabilistic"
+	StrategyRateLimiting  = "ratelimiting"
+)
+
+// Атрибуты корневого спана с выбранной стратегией, как у jaeger-client.
+const (
+	SamplerTypeKey  = attribute.Key("sampler.type")
+	SamplerParamKey = attribute.Key("sampler.param")
+)
+
+// Rules - правила сэмплирования из файла TRACE_SAMPLING_FILE (YAML или JSON):
+//
+//	parent_based: true
+//	default: {type: probabilistic, param: 0.01}
+//	endpoints:
+//	  - {method: GET, path: "/users/*", strategy: {type: ratelimiting, param: 5}}
+//	  - {path: "/debug/*", strategy: {type: const, param: 0}}
+//	tail:
+//	  errors: true
+//	  latency_threshold: 500ms
+type Rules struct {
+	// ParentBased - спаны с входящим контекстом следуют решению вызывающего сервиса.
+	ParentBased bool `yaml:"parent_based"`
+	// Default - стратегия для запросов, не подошедших ни под одно правило Endpoints.
+	Default Strategy `yaml:"default"`
+	// Endpoints проверяются по порядку, срабатывает первое подходящее.
+	Endpoints []EndpointRule `yaml:"endpoints"`
+	Tail      TailRule       `yaml:"tail"`
+}
+
+// Strategy - const (param 1 - всё, 0 - ничего), probabilistic (доля от 0 до 1)
+// или ratelimiting (трейсов в секунду).
+type Strategy struct {
+	Type  string  `yaml:"type"`
+	Param float64 `yaml:"param"`
+}
+
+// EndpointRule - стратегия для запросов с методом Method (пусто - любой) и путём,
+// подходящим под шаблон path.Match.
+type EndpointRule struct {
+	Method   string   `yaml:"method"`
+	Path     string   `yaml:"path"`
+	Strategy Strategy `yaml:"strategy"`
+}
+
+// TailRule - трейсы, не попавшие в выборку, всё равно отправляются, если запрос
+// закончился ошибкой (5xx или статус Error) или шёл дольше LatencyThreshold.
+type TailRule struct {
+	Errors           bool   `yaml:"errors"`
+	LatencyThreshold string `yaml:"latency_threshold"`
+}
+
+// DefaultRules - поведение без файла: решение родителя, иначе всё.
+func DefaultRules() Rules {
+	return Rules{ParentBased: true, Default: Strategy{Type: StrategyConst, Param: 1}}
+}
+
+// ParseRules разбирает правила в YAML или JSON.
+func ParseRules(data []byte) (Rules, error) {
+	var r Rules
+	if err := yaml.Unmarshal(data, &r); err != nil {
+		return Rules{}, fmt.Errorf("tracing: sampling rules: %w", err)
+	}
+	if _, err := compile(r); err != nil {
+		return Rules{}, err
+	}
+	return r, nil
+}
+
+// compiled - правила, готовые к применению; меняются целиком при перезагрузке.
+type compiled struct {
+	parentBased bool
+	def         *strategy
+	endpoints   []endpointRule
+	tailErrors  bool
+	tailLatency time.Duration
+}
+
+func (c *compiled) tail() bool {
+	return c.tailErrors || c.tailLatency > 0
+}
+
+type endpointRule struct {
+	method string
+	path   string
+	*strategy
+}
+
+func compile(r Rules) (*compiled, error) {
+	c := &compiled{parentBased: r.ParentBased, tailErrors: r.Tail.Errors}
+	var err error
+	if c.def, err = newStrategy(r.Default); err != nil {
+		return nil, fmt.Errorf("tracing: sampling rules: default: %w", err)
+	}
+	for i, e := range r.Endpoints {
+		if _, err := path.Match(e.Path, "/"); err != nil || e.Path == "" {
+			return nil, fmt.Errorf("tracing: sampling rules: endpoints[%d]: bad path %q", i, e.Path)
+		}
+		s, err := newStrategy(e.Strategy)
+		if err != nil {
+			return nil, fmt.Errorf("tracing: sampling rules: endpoints[%d]: %w", i, err)
+		}
+		c.endpoints = append(c.endpoints, endpointRule{method: strings.ToUpper(e.Method), path: e.Path, strategy: s})
+	}
+	if r.Tail.LatencyThreshold != "" {
+		if c.tailLatency, err = time.ParseDuration(r.Tail.LatencyThreshold); err != nil {
+			return nil, fmt.Errorf("tracing: sampling rules: tail.latency_threshold: %w", err)
+		}
+	}
+	return c, nil
+}
+
+func (c *compiled) match(method, target string) *strategy {
+	if i := strings.IndexByte(target, '?'); i >= 0 {
+		target = target[:i]
+	}
+	for _, e := range c.endpoints {
+		if e.method != "" && e.method != "*" && e.method != method {
+			continue
+		}
+		if ok, _ := path.Match(e.path, target); ok {
+			return e.strategy
+		}
+	}
+	return c.def
+}
+
+type strategy struct {
+	Strategy
+	ratio sdktrace.Sampler // probabilistic
+	// ratelimiting: token bucket на Param трейсов в секунду
+	mu      sync.Mutex
+	tokens  float64
+	updated time.Time
+}
+
+func newStrategy(s Strategy) (*strategy, error) {
+	ret := &strategy{Strategy: s}
+	switch s.Type {
+	case StrategyConst:
+	case StrategyProbabilistic:
+		if s.Param < 0 || s.Param > 1 {
+			return nil, fmt.Errorf("probabilistic param %v out of [0, 1]", s.Param)
+		}
+		ret.ratio = sdktrace.TraceIDRatioBased(s.Param)
+	case StrategyRateLimiting:
+		if s.Param < 0 {
+			return nil, fmt.Errorf("ratelimiting param %v is negative", s.Param)
+		}
+		// бакет начинается с Param: при 0 не сэмплируется и первый трейс
+		ret.tokens = s.Param
+	default:
+		return nil, fmt.Errorf("unknown strategy type %q, want %s, %s or %s",
+			s.Type, StrategyConst, StrategyProbabilistic, StrategyRateLimiting)
+	}
+	return ret, nil
+}
+
+func (s *strategy) sample(p sdktrace.SamplingParameters, now time.Time) bool {
+	switch s.Type {
+	case StrategyConst:
+		return s.Param >= 1
+	case StrategyProbabilistic:
+		return s.ratio.ShouldSample(p).Decision == sdktrace.RecordAndSample
+	default:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !s.updated.IsZero() {
+			s.tokens = math.Min(s.tokens+now.Sub(s.updated).Seconds()*s.Param, math.Max(s.Param, 1))
+		}
+		s.updated = now
+		if s.tokens < 1 {
+			return false
+		}
+		s.tokens--
+		return true
+	}
+}
+
+// Sampler - sdktrace.Sampler по правилам Rules, правила можно заменить на ходу через Update.
+type Sampler struct {
+	rules atomic.Value // *compiled
+	now   func() time.Time
+}
+
+// NewSampler создаёт сэмплер с правилами r.
+func NewSampler(r Rules) (*Sampler, error) {
+	s := &Sampler{now: time.Now}
+	if err := s.Update(r); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Update заменяет правила. При ошибке остаются прежние.
+func (s *Sampler) Update(r Rules) error {
+	c, err := compile(r)
+	if err != nil {
+		return err
+	}
+	s.rules.Store(c)
+	return nil
+}
+
+func (s *Sampler) current() *compiled {
+	return s.rules.Load().(*compiled)
+}
+
+// ShouldSample: дочерние спаны внутри процесса наследуют решение родителя; входящий
+// контекст учитывается при parent_based; остальное решает стратегия эндпоинта.
+// Если включены правила tail, не попавшие в выборку спаны всё равно записываются
+// (RecordOnly), чтобы tailProcessor мог отправить трейс после его завершения.
+func (s *Sampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	c := s.current()
+	parent := trace.SpanContextFromContext(p.ParentContext)
+	res := sdktrace.SamplingResult{Tracestate: parent.TraceState()}
+
+	switch {
+	case parent.IsValid() && !parent.IsRemote():
+		switch {
+		case parent.IsSampled():
+			res.Decision = sdktrace.RecordAndSample
+		case trace.SpanFromContext(p.ParentContext).IsRecording():
+			res.Decision = sdktrace.RecordOnly
+		}
+		return res
+	case parent.IsValid() && c.parentBased:
+		if parent.IsSampled() {
+			res.Decision = sdktrace.RecordAndSample
+			return res
+		}
+	default:
+		var method, target string
+		for _, kv := range p.Attributes {
+			switch kv.Key {
+			case semconv.HTTPMethodKey:
+				method = kv.Value.AsString()
+			case semconv.HTTPTargetKey:
+				target = kv.Value.AsString()
+			}
+		}
+		st := c.match(method, target)
+		if st.sample(p, s.now()) {
+			res.Decision = sdktrace.RecordAndSample
+			res.Attributes = []attribute.KeyValue{
+				SamplerTypeKey.String(st.Type),
+				SamplerParamKey.Float64(st.Param),
+			}
+			return res
+		}
+	}
+	if c.tail() {
+		res.Decision = sdktrace.RecordOnly
+	}
+	return res
+}
+
+func (s *Sampler) Description() string {
+	return "RulesSampler"
+}
+
+// watch перечитывает file, когда меняется его mtime. Ошибки уходят в otel.Handle,
+// правила при этом не меняются. Возвращает функцию остановки.
+func (s *Sampler) watch(file string, every time.Duration) func() {
+	var mod time.Time
+	if fi, err := os.Stat(file); err == nil {
+		mod = fi.ModTime()
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+			fi, err := os.Stat(file)
+			if err != nil {
+				otel.Handle(fmt.Errorf("tracing: sampling rules: %w", err))
+				continue
+			}
+			if fi.ModTime().Equal(mod) {
+				continue
+			}
+			mod = fi.ModTime()
+			if err := s.load(file); err != nil {
+				otel.Handle(err)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+func (s *Sampler) load(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("tracing: sampling rules: %w", err)
+	}
+	r, err := ParseRules(data)
+	if err != nil {
+		return fmt.Errorf("%w (%s)", err, file)
+	}
+	return s.Update(r)
+}
@@ -0,0 +1,192 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	gc "gopkg.in/check.v1"
+)
+
+func request(method, target string) trace.SpanStartOption {
+	return trace.WithAttributes(semconv.HTTPMethodKey.String(method), semconv.HTTPTargetKey.String(target))
+}
+
+func sampled(ctx context.Context, tp trace.TracerProvider, opts ...trace.SpanStartOption) bool {
+	_, span := tp.Tracer("test").Start(ctx, "span", opts...)
+	defer span.End()
+	return span.SpanContext().IsSampled()
+}
+
+func (s *TracingSuite) TestEndpointRules(c *gc.C) {
+	r, err := ParseRules([]byte(`
+default: {type: probabilistic, param: 0}
+endpoints:
+  - {method: GET, path: "/users/*", strategy: {type: const, param: 1}}
+  - {path: "/debug/*", strategy: {type: const, param: 0}}
+`))
+	c.Assert(err, gc.IsNil)
+	sm, err := NewSampler(r)
+	c.Assert(err, gc.IsNil)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sm))
+
+	c.Assert(sampled(context.Background(), tp, request("GET", "/users/42?full=1")), gc.Equals, true)
+	c.Assert(sampled(context.Background(), tp, request("POST", "/users/42")), gc.Equals, false)
+	c.Assert(sampled(context.Background(), tp, request("GET", "/users/42/articles")), gc.Equals, false)
+	c.Assert(sampled(context.Background(), tp, request("GET", "/debug/pprof")), gc.Equals, false)
+}
+
+func (s *TracingSuite) TestParentBased(c *gc.C) {
+	remote := func(flags trace.TraceFlags) context.Context {
+		return trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1},
+			SpanID:     trace.SpanID{1},
+			TraceFlags: flags,
+			Remote:     true,
+		}))
+	}
+	sm, err := NewSampler(Rules{ParentBased: true, Default: Strategy{Type: StrategyConst, Param: 0}})
+	c.Assert(err, gc.IsNil)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sm))
+	c.Assert(sampled(remote(trace.FlagsSampled), tp), gc.Equals, true)
+	c.Assert(sampled(remote(0), tp), gc.Equals, false)
+
+	// без parent_based решает своя стратегия
+	c.Assert(sm.Update(Rules{Default: Strategy{Type: StrategyConst, Param: 0}}), gc.IsNil)
+	c.Assert(sampled(remote(trace.FlagsSampled), tp), gc.Equals, false)
+
+	// дочерний спан внутри процесса всегда следует родителю
+	ctx, parent := sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.AlwaysSample())).
+		Tracer("test").Start(context.Background(), "parent")
+	defer parent.End()
+	c.Assert(sampled(ctx, tp), gc.Equals, true)
+}
+
+func (s *TracingSuite) TestRateLimiting(c *gc.C) {
+	sm, err := NewSampler(Rules{Default: Strategy{Type: StrategyRateLimiting, Param: 2}})
+	c.Assert(err, gc.IsNil)
+	now := time.Unix(1000, 0)
+	sm.now = func() time.Time { return now }
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sm))
+
+	c.Assert(sampled(context.Background(), tp), gc.Equals, true)
+	c.Assert(sampled(context.Background(), tp), gc.Equals, true)
+	c.Assert(sampled(context.Background(), tp), gc.Equals, false)
+	now = now.Add(500 * time.Millisecond)
+	c.Assert(sampled(context.Background(), tp), gc.Equals, true)
+	c.Assert(sampled(context.Background(), tp), gc.Equals, false)
+}
+
+func (s *TracingSuite) TestRateLimitingZero(c *gc.C) {
+	sm, err := NewSampler(Rules{Default: Strategy{Type: StrategyRateLimiting, Param: 0}})
+	c.Assert(err, gc.IsNil)
+	now := time.Unix(1000, 0)
+	sm.now = func() time.Time { return now }
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sm))
+
+	c.Assert(sampled(context.Background(), tp), gc.Equals, false)
+	now = now.Add(time.Minute)
+	c.Assert(sampled(context.Background(), tp), gc.Equals, false)
+}
+
+func (s *TracingSuite) TestBadRules(c *gc.C) {
+	_, err := ParseRules([]byte(`default: {type: remote}`))
+	c.Assert(err, gc.ErrorMatches, `tracing: sampling rules: default: unknown strategy type "remote".*`)
+	_, err = ParseRules([]byte(`{"default": {"type": "probabilistic", "param": 2}}`))
+	c.Assert(err, gc.ErrorMatches, `.*probabilistic param 2 out of \[0, 1\]`)
+	_, err = ParseRules([]byte(`{"default": {"type": "const"}, "tail": {"latency_threshold": "soon"}}`))
+	c.Assert(err, gc.ErrorMatches, `.*tail.latency_threshold.*`)
+}
+
+func (s *TracingSuite) TestTailKeepsErrorsAndSlowTraces(c *gc.C) {
+	sm, err := NewSampler(Rules{
+		Default: Strategy{Type: StrategyConst, Param: 0},
+		Tail:    TailRule{Errors: true, LatencyThreshold: "1s"},
+	})
+	c.Assert(err, gc.IsNil)
+	exp := tracetest.NewInMemoryExporter()
+	tail := newTailProcessor(sm, exp)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sm), sdktrace.WithSpanProcessor(tail))
+	tr := tp.Tracer("test")
+
+	run := func(name string, status int, took time.Duration) {
+		start := time.Now()
+		ctx, root := tr.Start(context.Background(), name, trace.WithTimestamp(start))
+		c.Assert(root.SpanContext().IsSampled(), gc.Equals, false)
+		c.Assert(root.IsRecording(), gc.Equals, true)
+		_, child := tr.Start(ctx, name+"/db")
+		child.End()
+		root.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		root.End(trace.WithTimestamp(start.Add(took)))
+	}
+	run("ok", 200, time.Millisecond)
+	run("failed", 503, time.Millisecond)
+	run("slow", 200, 2*time.Second)
+
+	_, errSpan := tr.Start(context.Background(), "error status")
+	errSpan.SetStatus(codes.Error, "boom")
+	errSpan.End()
+
+	c.Assert(tail.ForceFlush(context.Background()), gc.IsNil)
+	names := map[string]bool{}
+	for _, sp := range exp.GetSpans() {
+		names[sp.Name] = true
+	}
+	c.Assert(names, gc.DeepEquals, map[string]bool{
+		"failed": true, "failed/db": true,
+		"slow": true, "slow/db": true,
+		"error status": true,
+	})
+	c.Assert(tail.traces, gc.HasLen, 0)
+}
+
+func (s *TracingSuite) TestSampledSpansCarrySamplerAttributes(c *gc.C) {
+	sr := tracetest.NewSpanRecorder()
+	p, err := New(context.Background(), "svc", Config{Exporter: ExporterNone}, sdktrace.WithSpanProcessor(sr))
+	c.Assert(err, gc.IsNil)
+	defer func() { _ = p.Shutdown(context.Background()) }()
+
+	_, span := p.Tracer("test").Start(context.Background(), "root")
+	span.End()
+	c.Assert(sr.Ended(), gc.HasLen, 1)
+	attrs := attribute.NewSet(sr.Ended()[0].Attributes()...)
+	v, _ := attrs.Value(SamplerTypeKey)
+	c.Assert(v.AsString(), gc.Equals, StrategyConst)
+}
+
+func (s *TracingSuite) TestSamplingFileReload(c *gc.C) {
+	file := filepath.Join(c.MkDir(), "sampling.yaml")
+	c.Assert(os.WriteFile(file, []byte("default: {type: const, param: 0}\n"), 0o600), gc.IsNil)
+
+	p, err := New(context.Background(), "svc", Config{
+		Exporter:       ExporterNone,
+		SamplingFile:   file,
+		SamplingReload: 10 * time.Millisecond,
+	})
+	c.Assert(err, gc.IsNil)
+	defer func() { _ = p.Shutdown(context.Background()) }()
+	c.Assert(sampled(context.Background(), p), gc.Equals, false)
+
+	// сломанный файл не меняет правил
+	c.Assert(os.WriteFile(file, []byte("default: {type: nope}\n"), 0o600), gc.IsNil)
+	c.Assert(os.Chtimes(file, time.Now(), time.Now().Add(time.Second)), gc.IsNil)
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(sampled(context.Background(), p), gc.Equals, false)
+
+	c.Assert(os.WriteFile(file, []byte("default: {type: const, param: 1}\n"), 0o600), gc.IsNil)
+	c.Assert(os.Chtimes(file, time.Now(), time.Now().Add(2*time.Second)), gc.IsNil)
+	deadline := time.Now().Add(2 * time.Second)
+	for !sampled(context.Background(), p) {
+		if time.Now().After(deadline) {
+			c.Fatal("sampling rules were not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,140 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Ограничения буфера tailProcessor: трейсы, корень которых не закончился за
+// tailTraceTTL, выбрасываются; сверх лимитов спаны не буферизуются.
+const (
+	tailMaxTraces   = 10000
+	tailMaxSpans    = 1000
+	tailTraceTTL    = time.Minute
+	tailExportLimit = 30 * time.Second
+)
+
+// tailProcessor копит спаны, не попавшие в выборку (Sampler вернул RecordOnly),
+// и отправляет трейс целиком, если его локальный корень закончился ошибкой или
+// превысил порог задержки. BatchSpanProcessor такие спаны пропускает, поэтому
+// отправка идёт прямо в exporter.
+type tailProcessor struct {
+	sampler  *Sampler
+	exporter sdktrace.SpanExporter
+
+	mu     sync.Mutex
+	traces map[trace.TraceID]*tailTrace
+	wg     sync.WaitGroup
+}
+
+type tailTrace struct {
+	started time.Time
+	spans   []sdktrace.ReadOnlySpan
+}
+
+func newTailProcessor(s *Sampler, exp sdktrace.SpanExporter) *tailProcessor {
+	return &tailProcessor{sampler: s, exporter: exp, traces: map[trace.TraceID]*tailTrace{}}
+}
+
+func (p *tailProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (p *tailProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	sc := s.SpanContext()
+	if sc.IsSampled() {
+		return
+	}
+	root := !s.Parent().IsValid() || s.Parent().IsRemote()
+
+	p.mu.Lock()
+	t := p.traces[sc.TraceID()]
+	if t == nil && !root {
+		if len(p.traces) >= tailMaxTraces {
+			p.evictLocked(s.EndTime())
+		}
+		if len(p.traces) >= tailMaxTraces {
+			p.mu.Unlock()
+			return
+		}
+		t = &tailTrace{started: s.StartTime()}
+		p.traces[sc.TraceID()] = t
+	}
+	if t != nil && len(t.spans) < tailMaxSpans {
+		t.spans = append(t.spans, s)
+	}
+	if root {
+		delete(p.traces, sc.TraceID())
+	}
+	p.mu.Unlock()
+
+	if !root || !p.keep(s) {
+		return
+	}
+	spans := []sdktrace.ReadOnlySpan{s}
+	if t != nil {
+		spans = t.spans
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), tailExportLimit)
+		defer cancel()
+		if err := p.exporter.ExportSpans(ctx, spans); err != nil {
+			otel.Handle(err)
+		}
+	}()
+}
+
+// keep - решение по завершённому корню трейса.
+func (p *tailProcessor) keep(root sdktrace.ReadOnlySpan) bool {
+	c := p.sampler.current()
+	if c.tailLatency > 0 && root.EndTime().Sub(root.StartTime()) >= c.tailLatency {
+		return true
+	}
+	if !c.tailErrors {
+		return false
+	}
+	if root.Status().Code == codes.Error {
+		return true
+	}
+	for _, kv := range root.Attributes() {
+		if kv.Key == semconv.HTTPStatusCodeKey && kv.Value.AsInt64() >= 500 {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *tailProcessor) evictLocked(now time.Time) {
+	for id, t := range p.traces {
+		if now.Sub(t.started) > tailTraceTTL {
+			delete(p.traces, id)
+		}
+	}
+}
+
+// Shutdown дожидается начатых отправок. Процессор регистрируется раньше батчера,
+// поэтому exporter к этому моменту ещё не остановлен.
+func (p *tailProcessor) Shutdown(ctx context.Context) error {
+	return p.ForceFlush(ctx)
+}
+
+func (p *tailProcessor) ForceFlush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
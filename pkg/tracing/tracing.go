@@ -0,0 +1,183 @@
+// Package tracing - настройка OpenTelemetry TracerProvider для сервисов.
+//
+// Экспортёр выбирается настройкой: OTLP по gRPC или HTTP в коллектор (например, Jaeger
+// с включённым OTLP), stdout для отладки или none. Контекст между сервисами передаётся
+// в заголовках W3C traceparent/tracestate и baggage. Какие трейсы отправлять, решает
+// Sampler по правилам из файла (см. Rules), файл перечитывается на ходу.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+const (
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterOTLPHTTP = "otlp-http"
+	ExporterStdout   = "stdout"
+	ExporterNone     = "none"
+)
+
+// Config - настройки трейсинга, встраиваются в Config сервиса.
+type Config struct {
+	// Exporter - "otlp-grpc", "otlp-http", "stdout" или "none".
+	Exporter string `json:"exporter" env:"TRACE_EXPORTER" default:"otlp-grpc"`
+	// Endpoint - host:port коллектора, по умолчанию localhost:4317 для gRPC и localhost:4318 для HTTP.
+	Endpoint string `json:"endpoint" env:"TRACE_ENDPOINT"`
+	Insecure bool   `json:"insecure" env:"TRACE_INSECURE" default:"true"`
+	// SamplingFile - файл с правилами Rules; без него сэмплируется всё, с учётом решения родителя.
+	SamplingFile string `json:"sampling_file" env:"TRACE_SAMPLING_FILE"`
+	// SamplingReload - как часто проверять, не изменился ли SamplingFile.
+	SamplingReload time.Duration `json:"sampling_reload" env:"TRACE_SAMPLING_RELOAD" default:"10s"`
+}
+
+// Provider - TracerProvider с проверкой состояния экспорта для /readyz.
+type Provider struct {
+	*sdktrace.TracerProvider
+	exporter *statusExporter
+	sampler  *Sampler
+	stop     func()
+}
+
+// New создаёт провайдер для сервиса service. opts добавляются после стандартных,
+// например sdktrace.WithSampler или sdktrace.WithSpanProcessor(tracetest.NewSpanRecorder()) в тестах.
+func New(ctx context.Context, service string, cfg Config, opts ...sdktrace.TracerProviderOption) (*Provider, error) {
+	exp, err := newExporter(ctx, cfg, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(service),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: resource: %w", err)
+	}
+
+	p := &Provider{}
+	if p.sampler, err = NewSampler(DefaultRules()); err != nil {
+		return nil, err
+	}
+	if cfg.SamplingFile != "" {
+		if err := p.sampler.load(cfg.SamplingFile); err != nil {
+			return nil, err
+		}
+		if cfg.SamplingReload > 0 {
+			p.stop = p.sampler.watch(cfg.SamplingFile, cfg.SamplingReload)
+		}
+	}
+	all := []sdktrace.TracerProviderOption{sdktrace.WithResource(res), sdktrace.WithSampler(p.sampler)}
+	if exp != nil {
+		p.exporter = &statusExporter{SpanExporter: exp}
+		// tailProcessor раньше батчера: при Shutdown он успевает отправить своё до остановки exporter
+		all = append(all,
+			sdktrace.WithSpanProcessor(newTailProcessor(p.sampler, p.exporter)),
+			sdktrace.WithBatcher(p.exporter))
+	}
+	p.TracerProvider = sdktrace.NewTracerProvider(append(all, opts...)...)
+	return p, nil
+}
+
+// Sampler - сэмплер провайдера, правила можно заменить через Update.
+func (p *Provider) Sampler() *Sampler {
+	return p.sampler
+}
+
+// Shutdown останавливает перечитывание правил и отправляет оставшиеся спаны.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p.stop != nil {
+		p.stop()
+		p.stop = nil
+	}
+	return p.TracerProvider.Shutdown(ctx)
+}
+
+func newExporter(ctx context.Context, cfg Config, stdout io.Writer) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case ExporterOTLPGRPC:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint(cfg, "localhost:4317"))}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case ExporterOTLPHTTP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint(cfg, "localhost:4318"))}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(stdout))
+	case ExporterNone, "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q, want %s, %s, %s or %s",
+			cfg.Exporter, ExporterOTLPGRPC, ExporterOTLPHTTP, ExporterStdout, ExporterNone)
+	}
+}
+
+func endpoint(cfg Config, def string) string {
+	if cfg.Endpoint != "" {
+		return cfg.Endpoint
+	}
+	return def
+}
+
+// Propagator - W3C tracecontext и baggage.
+func Propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
+
+// Install делает p глобальным провайдером и включает Propagator для otel.GetTextMapPropagator.
+func (p *Provider) Install() {
+	otel.SetTracerProvider(p)
+	otel.SetTextMapPropagator(Propagator())
+}
+
+// Check - проверка для health.Checker: ошибка последней отправки спанов, если она была.
+func (p *Provider) Check(ctx context.Context) error {
+	if p.exporter == nil {
+		return nil
+	}
+	return p.exporter.check()
+}
+
+// statusExporter запоминает результат последней отправки.
+type statusExporter struct {
+	sdktrace.SpanExporter
+
+	mu      sync.Mutex
+	lastErr error
+	lastAt  time.Time
+}
+
+func (e *statusExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.mu.Lock()
+	e.lastErr = err
+	e.lastAt = time.Now()
+	e.mu.Unlock()
+	return err
+}
+
+func (e *statusExporter) check() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.lastErr != nil {
+		return fmt.Errorf("last export at %s: %w", e.lastAt.Format(time.RFC3339), e.lastErr)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	gc "gopkg.in/check.v1"
+)
+
+var _ = gc.Suite(new(TracingSuite))
+
+type TracingSuite struct{}
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+func (s *TracingSuite) TestProviderRecordsSpans(c *gc.C) {
+	sr := tracetest.NewSpanRecorder()
+	p, err := New(context.Background(), "test-service", Config{Exporter: ExporterNone}, sdktrace.WithSpanProcessor(sr))
+	c.Assert(err, gc.IsNil)
+	defer func() { _ = p.Shutdown(context.Background()) }()
+
+	ctx, parent := p.Tracer("test").Start(context.Background(), "parent")
+	_, child := p.Tracer("test").Start(ctx, "child")
+	child.End()
+	parent.End()
+
+	ended := sr.Ended()
+	c.Assert(ended, gc.HasLen, 2)
+	c.Assert(ended[0].Name(), gc.Equals, "child")
+	c.Assert(ended[0].Parent().SpanID(), gc.Equals, ended[1].SpanContext().SpanID())
+	c.Assert(ended[1].Resource().Set().HasValue(semconv.ServiceNameKey), gc.Equals, true)
+	v, _ := ended[1].Resource().Set().Value(semconv.ServiceNameKey)
+	c.Assert(v.AsString(), gc.Equals, "test-service")
+}
+
+func (s *TracingSuite) TestUnknownExporter(c *gc.C) {
+	_, err := New(context.Background(), "svc", Config{Exporter: "zipkin"})
+	c.Assert(err, gc.ErrorMatches, `tracing: unknown exporter "zipkin".*`)
+}
+
+func (s *TracingSuite) TestStdoutExporter(c *gc.C) {
+	var buf bytes.Buffer
+	exp, err := newExporter(context.Background(), Config{Exporter: ExporterStdout}, &buf)
+	c.Assert(err, gc.IsNil)
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	_, span := tp.Tracer("test").Start(context.Background(), "printed")
+	span.End()
+	c.Assert(buf.String(), gc.Matches, `(?s).*"Name":"printed".*`)
+}
+
+type failingExporter struct{ *tracetest.NoopExporter }
+
+func (failingExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error {
+	return errors.New("collector unavailable")
+}
+
+func (s *TracingSuite) TestCheckReportsExportError(c *gc.C) {
+	st := &statusExporter{SpanExporter: failingExporter{tracetest.NewNoopExporter()}}
+	p := &Provider{TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(st)), exporter: st}
+	c.Assert(p.Check(context.Background()), gc.IsNil)
+
+	_, span := p.Tracer("test").Start(context.Background(), "lost")
+	span.End()
+	c.Assert(p.Check(context.Background()), gc.ErrorMatches, "last export at .*: collector unavailable")
+}
+
+func (s *TracingSuite) TestPropagatorCarriesContextAndBaggage(c *gc.C) {
+	tp := sdktrace.NewTracerProvider()
+	ctx, span := tp.Tracer("test").Start(context.Background(), "client")
+	defer span.End()
+	m, err := baggage.NewMember("tenant", "acme")
+	c.Assert(err, gc.IsNil)
+	b, err := baggage.New(m)
+	c.Assert(err, gc.IsNil)
+	ctx = baggage.ContextWithBaggage(ctx, b)
+
+	h := http.Header{}
+	Propagator().Inject(ctx, propagation.HeaderCarrier(h))
+	c.Assert(h.Get("traceparent"), gc.Not(gc.Equals), "")
+	c.Assert(h.Get("baggage"), gc.Equals, "tenant=acme")
+
+	got := Propagator().Extract(context.Background(), propagation.HeaderCarrier(h))
+	c.Assert(trace.SpanContextFromContext(got).TraceID(), gc.Equals, span.SpanContext().TraceID())
+	c.Assert(baggage.FromContext(got).Member("tenant").Value(), gc.Equals, "acme")
+}